@@ -0,0 +1,83 @@
+package chain
+
+import (
+	"io"
+	"reflect"
+)
+
+// WriterFunc lifts a constructor of a plain io.Writer, such as hex.NewEncoder
+// or gzip.NewWriter, into a WriteChain.
+//
+// If the writer it returns is also an io.Closer, closing the stage closes it
+// before closing the writer it wraps. Otherwise, or if f returns the writer it was given,
+// only the wrapped writer is closed, after flushing the writer if it has a Flush() error method,
+// like bufio.Writer.
+func WriterFunc[W io.Writer](f func(io.Writer) W) WriteChain {
+	return WriterFuncErr(func(w io.Writer) (W, error) {
+		return f(w), nil
+	})
+}
+
+// WriterFuncErr is like WriterFunc, for constructors that can fail, such as gzip.NewWriterLevel
+func WriterFuncErr[W io.Writer](f func(io.Writer) (W, error)) WriteChain {
+	return func(w io.WriteCloser) (io.WriteCloser, error) {
+		newW, err := f(w)
+		if err != nil {
+			return nil, err
+		}
+		if wc, ok := any(newW).(io.WriteCloser); ok && !same(newW, w) {
+			return WriteCloser2{WriteCloser: wc, Closer: w}, nil
+		}
+		if f, ok := any(newW).(flusher); ok && !same(newW, w) {
+			return WriteCloser2{WriteCloser: flushCloser{Writer: newW, flusher: f}, Closer: w}, nil
+		}
+		return WriteCloser2{WriteCloser: NopWriteCloser{Writer: newW}, Closer: w}, nil
+	}
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// flushCloser flushes a writer, such as a bufio.Writer, when it's closed
+type flushCloser struct {
+	io.Writer
+	flusher
+}
+
+func (f flushCloser) Close() error {
+	return f.Flush()
+}
+
+// ReaderFunc lifts a constructor of a plain io.Reader, such as hex.NewDecoder
+// or bufio.NewReader, into a ReadChain.
+//
+// If the reader it returns is also an io.Closer, closing the stage closes it
+// before closing the reader it wraps. Otherwise, or if f returns the reader it was given,
+// only the wrapped reader is closed.
+func ReaderFunc[R io.Reader](f func(io.Reader) R) ReadChain {
+	return ReaderFuncErr(func(r io.Reader) (R, error) {
+		return f(r), nil
+	})
+}
+
+// ReaderFuncErr is like ReaderFunc, for constructors that can fail, such as gzip.NewReader
+func ReaderFuncErr[R io.Reader](f func(io.Reader) (R, error)) ReadChain {
+	return func(r io.ReadCloser) (io.ReadCloser, error) {
+		newR, err := f(r)
+		if err != nil {
+			return nil, err
+		}
+		if rc, ok := any(newR).(io.ReadCloser); ok && !same(newR, r) {
+			return ReadCloser2{ReadCloser: rc, Closer: r}, nil
+		}
+		return ReadCloser{Reader: newR, Closer: r}, nil
+	}
+}
+
+// same reports whether a and b are the same value, without
+// panicking if their type isn't comparable
+func same(a, b interface{}) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t != nil && t.Comparable() && a == b
+}
@@ -0,0 +1,87 @@
+package chain_test
+
+import (
+	"bufio"
+	"bytes"
+	gz "compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdapters(t *testing.T) {
+	var closed bool
+	output := &closeRecorder{closed: &closed}
+
+	w, err := chain.NewWriteBuilder(chain.WriterFunc(gz.NewWriter)).
+		Then(encoding.Hex.Encode).
+		WritingTo(output)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputLower)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	assert.True(t, closed)
+
+	r, err := chain.ReadingFrom(io.NopCloser(&output.Buffer)).
+		Then(encoding.Hex.Decode).
+		Then(chain.ReaderFuncErr(gz.NewReader)).
+		Finally(chain.ReaderFunc(bufio.NewReader))
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+	assert.Equal(t, inputLower, string(b))
+
+	_, err = chain.ReadingFrom(io.NopCloser(bytes.NewReader([]byte("not a gzip stream")))).
+		Finally(chain.ReaderFuncErr(gz.NewReader))
+	assert.ErrorIs(t, err, gz.ErrHeader)
+
+	// buffered writers are flushed before the writer they wrap is closed
+	buf := &chain.Buffer{}
+	w, err = chain.NewWriteBuilder(chain.WriterFunc(bufio.NewWriter)).WritingTo(buf)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputLower)
+	require.Nil(t, err)
+	assert.Equal(t, 0, buf.Len())
+	require.Nil(t, w.Close())
+	assert.Equal(t, inputLower, buf.String())
+
+	// a constructor that returns the writer it's given doesn't close it twice
+	counter := &closeCounter{}
+	w, err = chain.NewWriteBuilder(chain.WriterFunc(func(w io.Writer) io.Writer { return w })).
+		WritingTo(counter)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	assert.Equal(t, 1, counter.closes)
+
+	counter = &closeCounter{}
+	r, err = chain.ReadingFrom(counter).Finally(chain.ReaderFunc(func(r io.Reader) io.Reader { return r }))
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+	assert.Equal(t, 1, counter.closes)
+}
+
+type closeRecorder struct {
+	bytes.Buffer
+	closed *bool
+}
+
+func (c *closeRecorder) Close() error {
+	*c.closed = true
+	return nil
+}
+
+type closeCounter struct {
+	bytes.Buffer
+	closes int
+}
+
+func (c *closeCounter) Close() error {
+	c.closes++
+	return nil
+}
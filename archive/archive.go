@@ -0,0 +1,87 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+)
+
+type readerStat interface {
+	io.ReaderAt
+	Stat() (fs.FileInfo, error)
+}
+
+// readerAt gives random access to r. If r doesn't support it,
+// r is read into memory. If maxMemory is positive, inputs larger than
+// maxMemory are spilled to a temporary file in tempDir instead,
+// which is removed when the returned io.Closer is closed
+func readerAt(r io.Reader, maxMemory int64, tempDir string) (io.ReaderAt, int64, io.Closer, error) {
+	if rs, ok := r.(readerStat); ok {
+		fi, err := rs.Stat()
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return rs, fi.Size(), nopCloser{}, nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	var err error
+	if maxMemory > 0 {
+		_, err = io.CopyN(buf, r, maxMemory+1)
+		if err == nil {
+			return spill(buf, r, tempDir)
+		}
+		if err == io.EOF {
+			err = nil
+		}
+	} else {
+		_, err = io.Copy(buf, r)
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return bytes.NewReader(buf.Bytes()), int64(buf.Len()), nopCloser{}, nil
+}
+
+func spill(buf *bytes.Buffer, r io.Reader, tempDir string) (io.ReaderAt, int64, io.Closer, error) {
+	f, err := os.CreateTemp(tempDir, "chain-archive-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	tf := tempFile{f}
+
+	size, err := io.Copy(f, io.MultiReader(buf, r))
+	if err != nil {
+		tf.Close()
+		return nil, 0, nil, err
+	}
+	return f, size, tf, nil
+}
+
+type tempFile struct {
+	*os.File
+}
+
+func (f tempFile) Close() error {
+	err1 := f.File.Close()
+	err2 := os.Remove(f.Name())
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// dirEntry is an fs.DirEntry for an fs.FileInfo
+type dirEntry struct {
+	info fs.FileInfo
+}
+
+func (d dirEntry) Name() string               { return d.info.Name() }
+func (d dirEntry) IsDir() bool                { return d.info.IsDir() }
+func (d dirEntry) Type() fs.FileMode          { return d.info.Mode().Type() }
+func (d dirEntry) Info() (fs.FileInfo, error) { return d.info, nil }
@@ -0,0 +1,260 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/conradludgate/chain"
+)
+
+// TarConfig configures the headers of entries created in a tar archive.
+//
+// Mode defaults to 0644 and ModTime defaults to the time the entry is closed.
+// Header, if set, is called with the header of each entry before it is written,
+// so it can be changed per entry.
+type TarConfig struct {
+	Mode    int64
+	ModTime time.Time
+	Uid     int
+	Gid     int
+	Uname   string
+	Gname   string
+	Format  tar.Format
+	Header  func(*tar.Header)
+
+	// MaxMemory and TempDir are used by FSReader as in ZipConfig
+	MaxMemory int64
+	TempDir   string
+}
+
+// FSWriter writes a tar archive to w.
+//
+// Tar headers need to know the size of an entry before its contents,
+// so each entry is buffered in memory and only written to the archive once it is closed
+func (cfg TarConfig) FSWriter(w io.WriteCloser) (chain.WriteFS, error) {
+	return &tarFSWriter{tarW: tar.NewWriter(w), cfg: cfg}, nil
+}
+
+type tarFSWriter struct {
+	tarW    *tar.Writer
+	cfg     TarConfig
+	aborted bool
+}
+
+func (tarfs *tarFSWriter) Create(name string) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	if tarfs.aborted {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrClosed}
+	}
+	return &tarEntry{fs: tarfs, name: name}, nil
+}
+
+func (tarfs *tarFSWriter) Close() error {
+	if tarfs.aborted {
+		return fs.ErrClosed
+	}
+	return tarfs.tarW.Close()
+}
+
+// Abort stops any more entries being written to the archive,
+// and leaves it without the trailer that marks the end of it
+func (tarfs *tarFSWriter) Abort(error) error {
+	tarfs.aborted = true
+	return nil
+}
+
+type tarEntry struct {
+	bytes.Buffer
+	fs     *tarFSWriter
+	name   string
+	closed bool
+}
+
+func (e *tarEntry) Close() error {
+	if e.closed || e.fs.aborted {
+		return nil
+	}
+	e.closed = true
+
+	cfg := e.fs.cfg
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.name,
+		Size:     int64(e.Len()),
+		Mode:     cfg.Mode,
+		ModTime:  cfg.ModTime,
+		Uid:      cfg.Uid,
+		Gid:      cfg.Gid,
+		Uname:    cfg.Uname,
+		Gname:    cfg.Gname,
+		Format:   cfg.Format,
+	}
+	if hdr.Mode == 0 {
+		hdr.Mode = 0o644
+	}
+	if hdr.ModTime.IsZero() {
+		hdr.ModTime = time.Now()
+	}
+	if cfg.Header != nil {
+		cfg.Header(hdr)
+	}
+
+	if err := e.fs.tarW.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := e.WriteTo(e.fs.tarW)
+	return err
+}
+
+// FSReader indexes the entries of the tar archive in r, so they can be opened by name.
+// Only regular files can be opened.
+//
+// Like ZipConfig.FSReader, r needs random access. If it isn't an io.ReaderAt with a Stat method,
+// such as an *os.File, the whole archive is read before any entry can be opened, and kept until
+// the ReadFS is closed. This is always the case when r comes through a chain, such as from
+// Decompress, so a .tar.gz is held in memory uncompressed, and the memory used grows with the
+// size of the archive, not of the entries that are opened. Set MaxMemory to spill larger
+// archives to a temporary file in TempDir instead.
+func (cfg TarConfig) FSReader(r io.ReadCloser) (chain.ReadFS, error) {
+	ra, size, closer, err := readerAt(r, cfg.MaxMemory, cfg.TempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sr := io.NewSectionReader(ra, 0, size)
+	tarR := tar.NewReader(sr)
+	t := tarFSReader{
+		entries: make(map[string]tarFile),
+		dirs:    map[string]map[string]bool{".": {}},
+		closer:  closer,
+	}
+	for {
+		hdr, err := tarR.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
+
+		name := path.Clean(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			// tar.Reader doesn't read ahead, so the contents start where the header ended
+			offset, err := sr.Seek(0, io.SeekCurrent)
+			if err != nil {
+				closer.Close()
+				return nil, err
+			}
+			t.entries[name] = tarFile{hdr: hdr, sr: io.NewSectionReader(ra, offset, hdr.Size)}
+		case tar.TypeDir:
+			t.entries[name] = tarFile{hdr: hdr}
+			if t.dirs[name] == nil {
+				t.dirs[name] = make(map[string]bool)
+			}
+		default:
+			continue
+		}
+		t.addParents(name)
+	}
+
+	return t, nil
+}
+
+type tarFile struct {
+	hdr *tar.Header
+	sr  *io.SectionReader
+}
+
+type tarFSReader struct {
+	entries map[string]tarFile
+	// the names in each directory, including implicit ones
+	dirs   map[string]map[string]bool
+	closer io.Closer
+}
+
+func (t tarFSReader) addParents(name string) {
+	for name != "." && name != "/" {
+		dir := path.Dir(name)
+		if t.dirs[dir] == nil {
+			t.dirs[dir] = make(map[string]bool)
+		}
+		t.dirs[dir][path.Base(name)] = true
+		name = dir
+	}
+}
+
+func (t tarFSReader) Open(name string) (io.ReadCloser, error) {
+	f, ok := t.entries[path.Clean(name)]
+	if !ok || f.sr == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(io.NewSectionReader(f.sr, 0, f.sr.Size())), nil
+}
+
+func (t tarFSReader) Stat(name string) (fs.FileInfo, error) {
+	name = path.Clean(name)
+	if f, ok := t.entries[name]; ok {
+		return f.hdr.FileInfo(), nil
+	}
+	if _, ok := t.dirs[name]; ok {
+		hdr := &tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0o755}
+		return hdr.FileInfo(), nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (t tarFSReader) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = path.Clean(name)
+	children, ok := t.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for child := range children {
+		info, err := t.Stat(path.Join(name, child))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, dirEntry{info})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Glob matches every file and directory in the archive against pattern.
+// As path.Match never matches a '/' with a wildcard, this
+// has the same results as fs.Glob
+func (t tarFSReader) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for name := range t.dirs {
+		if ok, _ := path.Match(pattern, name); ok && name != "." {
+			matches = append(matches, name)
+		}
+	}
+	for name, f := range t.entries {
+		if ok, _ := path.Match(pattern, name); ok && f.sr != nil {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (t tarFSReader) Close() error {
+	return t.closer.Close()
+}
@@ -2,17 +2,29 @@ package archive
 
 import (
 	"archive/zip"
-	"bytes"
 	"io"
 	"io/fs"
 
 	"github.com/conradludgate/chain"
 )
 
+// ZipConfig configures zip archives.
+//
+// zip archives are read from their end, so FSReader needs random access to its input.
+// If the input isn't an io.ReaderAt with a Stat method, such as an *os.File,
+// it is read into memory first. If MaxMemory is set, inputs larger than it are
+// written to a temporary file in TempDir instead, which is removed when the ReadFS is closed.
+//
+// Alternatively, set Streaming to read the archive forwards, one entry at a time,
+// without buffering it. See FSReader for the limitations of streaming.
 type ZipConfig struct {
 	Comment    string
 	Offset     int64
 	Compressor zip.Compressor
+
+	MaxMemory int64
+	TempDir   string
+	Streaming bool
 }
 
 func (cfg ZipConfig) FSWriter(w io.WriteCloser) (chain.WriteFS, error) {
@@ -22,15 +34,19 @@ func (cfg ZipConfig) FSWriter(w io.WriteCloser) (chain.WriteFS, error) {
 		zipW.RegisterCompressor(zip.Deflate, cfg.Compressor)
 	}
 
-	return zipFSWriter{zipW: zipW, comment: cfg.Comment}, nil
+	return &zipFSWriter{zipW: zipW, comment: cfg.Comment}, nil
 }
 
 type zipFSWriter struct {
 	zipW    *zip.Writer
 	comment string
+	aborted bool
 }
 
-func (zipfs zipFSWriter) Create(name string) (io.WriteCloser, error) {
+func (zipfs *zipFSWriter) Create(name string) (io.WriteCloser, error) {
+	if zipfs.aborted {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrClosed}
+	}
 	f, err := zipfs.zipW.Create(name)
 	if err != nil {
 		return nil, err
@@ -38,55 +54,69 @@ func (zipfs zipFSWriter) Create(name string) (io.WriteCloser, error) {
 	return chain.NopWriteCloser{Writer: f}, nil
 }
 
-func (zipfs zipFSWriter) Close() error {
-	err1 := zipfs.zipW.SetComment(zipfs.comment)
-	err2 := zipfs.zipW.Close()
-	if err2 != nil {
-		return err2
+// Abort leaves the archive unfinished, without its central directory,
+// so it can't be mistaken for a complete archive
+func (zipfs *zipFSWriter) Abort(error) error {
+	zipfs.aborted = true
+	return nil
+}
+
+func (zipfs *zipFSWriter) Close() error {
+	if zipfs.aborted {
+		return fs.ErrClosed
 	}
-	return err1
+	return chain.JoinErrors(
+		zipfs.zipW.SetComment(zipfs.comment),
+		zipfs.zipW.Close(),
+	)
 }
 
+// FSReader reads the zip archive in r.
+//
+// If Streaming is set, the archive is read forwards using the local file headers,
+// without buffering. Files must then be opened in the order they appear in the archive:
+// opening a file skips over every file before it, and closes any file that's still open.
+// Only stored and deflated files are supported, and stored files must have their sizes
+// in the local file header.
 func (cfg ZipConfig) FSReader(r io.ReadCloser) (chain.ReadFS, error) {
-	var ra io.ReaderAt
-	var size int64
-	if rs, ok := r.(readerStat); ok {
-		ra = rs
-		fi, err := rs.Stat()
-		if err != nil {
-			return nil, err
-		}
-		size = fi.Size()
-	} else {
-		buf := bytes.NewBuffer(nil)
-		_, err := io.Copy(buf, r)
-		if err != nil {
-			return nil, err
-		}
-		ra = bytes.NewReader(buf.Bytes())
-		size = int64(buf.Len())
+	if cfg.Streaming {
+		return newZipStreamReader(r), nil
+	}
+
+	ra, size, closer, err := readerAt(r, cfg.MaxMemory, cfg.TempDir)
+	if err != nil {
+		return nil, err
 	}
 
 	zipR, err := zip.NewReader(ra, size)
 	if err != nil {
+		closer.Close()
 		return nil, err
 	}
-	return zipFSReader{zipR: zipR}, nil
+	return zipFSReader{zipR: zipR, closer: closer}, nil
 }
 
 type zipFSReader struct {
-	zipR *zip.Reader
+	zipR   *zip.Reader
+	closer io.Closer
 }
 
 func (z zipFSReader) Open(name string) (io.ReadCloser, error) {
 	return z.zipR.Open(name)
 }
 
-func (z zipFSReader) Close() error {
-	return nil
+func (z zipFSReader) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(z.zipR, name)
+}
+
+func (z zipFSReader) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(z.zipR, name)
+}
+
+func (z zipFSReader) Glob(pattern string) ([]string, error) {
+	return fs.Glob(z.zipR, pattern)
 }
 
-type readerStat interface {
-	io.ReaderAt
-	Stat() (fs.FileInfo, error)
+func (z zipFSReader) Close() error {
+	return z.closer.Close()
 }
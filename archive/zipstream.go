@@ -0,0 +1,335 @@
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+const (
+	localHeaderSignature    = 0x04034b50
+	centralHeaderSignature  = 0x02014b50
+	endOfDirectorySignature = 0x06054b50
+	dataDescriptorSignature = 0x08074b50
+
+	localHeaderLen = 26 // excluding signature
+	zip64ExtraID   = 0x0001
+
+	flagEncrypted      = 0x1
+	flagDataDescriptor = 0x8
+
+	uint32max = 1<<32 - 1
+)
+
+var (
+	errStreamUnsupported = errors.New("zip: file can't be streamed")
+
+	// errSuperseded is returned from reading a file after opening a file after it,
+	// which skipped over the rest of it
+	errSuperseded = fmt.Errorf("zip: file was closed by opening the next one: %w", fs.ErrClosed)
+)
+
+type zipStreamReader struct {
+	r     *countingReader
+	entry *zipStreamEntry
+	done  bool
+}
+
+func newZipStreamReader(r io.Reader) *zipStreamReader {
+	return &zipStreamReader{r: &countingReader{r: bufio.NewReader(r)}}
+}
+
+func (z *zipStreamReader) Open(name string) (io.ReadCloser, error) {
+	name = path.Clean(name)
+
+	if z.entry != nil {
+		err := z.entry.skip()
+		z.entry = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for !z.done {
+		hdr, err := z.next()
+		if err != nil {
+			return nil, err
+		}
+		if hdr == nil {
+			break
+		}
+
+		entry, err := newZipStreamEntry(z.r, hdr)
+		if err != nil && hdr.name == name {
+			return nil, err
+		}
+		if err == nil && hdr.name == name {
+			z.entry = entry
+			return entry, nil
+		}
+
+		if err := skipEntry(z.r, hdr, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (z *zipStreamReader) Close() error {
+	return nil
+}
+
+type localHeader struct {
+	name     string
+	flags    uint16
+	method   uint16
+	crc32    uint32
+	compSize uint64
+	size     uint64
+	zip64    bool
+}
+
+// next reads the next local file header.
+// It returns nil once the central directory is reached
+func (z *zipStreamReader) next() (*localHeader, error) {
+	var buf [localHeaderLen]byte
+	if _, err := io.ReadFull(z.r, buf[:4]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	switch binary.LittleEndian.Uint32(buf[:4]) {
+	case localHeaderSignature:
+	case centralHeaderSignature, endOfDirectorySignature:
+		z.done = true
+		return nil, nil
+	default:
+		return nil, zip.ErrFormat
+	}
+
+	if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	le := binary.LittleEndian
+	hdr := &localHeader{
+		flags:    le.Uint16(buf[2:]),
+		method:   le.Uint16(buf[4:]),
+		crc32:    le.Uint32(buf[10:]),
+		compSize: uint64(le.Uint32(buf[14:])),
+		size:     uint64(le.Uint32(buf[18:])),
+	}
+	nameLen, extraLen := int(le.Uint16(buf[22:])), int(le.Uint16(buf[24:]))
+
+	b := make([]byte, nameLen+extraLen)
+	if _, err := io.ReadFull(z.r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	hdr.name = path.Clean(string(b[:nameLen]))
+	if strings.HasSuffix(string(b[:nameLen]), "/") {
+		// keep directories from matching any file name
+		hdr.name += "/"
+	}
+
+	extra := b[nameLen:]
+	for len(extra) >= 4 {
+		id, size := le.Uint16(extra), int(le.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if id != zip64ExtraID {
+			continue
+		}
+		hdr.zip64 = true
+		if hdr.size == uint32max && len(field) >= 8 {
+			hdr.size = le.Uint64(field)
+			field = field[8:]
+		}
+		if hdr.compSize == uint32max && len(field) >= 8 {
+			hdr.compSize = le.Uint64(field)
+		}
+	}
+
+	return hdr, nil
+}
+
+type zipStreamEntry struct {
+	hdr    *localHeader
+	r      *countingReader
+	start  int64
+	data   io.Reader
+	comp   io.ReadCloser
+	crc    hash.Hash32
+	err    error
+	closed bool
+}
+
+func newZipStreamEntry(r *countingReader, hdr *localHeader) (*zipStreamEntry, error) {
+	if hdr.flags&flagEncrypted != 0 {
+		return nil, errStreamUnsupported
+	}
+
+	entry := &zipStreamEntry{hdr: hdr, r: r, start: r.n, crc: crc32.NewIEEE()}
+
+	// With a data descriptor, the size isn't known until after the contents.
+	// flate knows where its stream ends, but only reads exactly up to it
+	// if the reader it is given is an io.ByteReader
+	var comp io.Reader = r
+	if hdr.flags&flagDataDescriptor == 0 {
+		comp = &io.LimitedReader{R: r, N: int64(hdr.compSize)}
+	}
+
+	switch hdr.method {
+	case zip.Store:
+		if hdr.flags&flagDataDescriptor != 0 {
+			return nil, errStreamUnsupported
+		}
+		entry.comp = io.NopCloser(comp)
+	case zip.Deflate:
+		entry.comp = flate.NewReader(comp)
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+	entry.data = comp
+	return entry, nil
+}
+
+func (e *zipStreamEntry) Read(p []byte) (int, error) {
+	if e.closed {
+		return 0, fs.ErrClosed
+	}
+	return e.read(p)
+}
+
+func (e *zipStreamEntry) read(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.comp.Read(p)
+	e.crc.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		err = e.finish()
+	}
+	e.err = err
+	return n, err
+}
+
+// finish reads the data descriptor, if there is one,
+// and checks the contents match the checksum
+func (e *zipStreamEntry) finish() error {
+	if lr, ok := e.data.(*io.LimitedReader); ok {
+		if _, err := io.Copy(io.Discard, lr); err != nil {
+			return err
+		}
+	}
+
+	if e.hdr.flags&flagDataDescriptor != 0 {
+		compressed := e.r.n - e.start
+		var buf [24]byte
+		if _, err := io.ReadFull(e.r, buf[:4]); err != nil {
+			return unexpectedEOF(err)
+		}
+		crc := binary.LittleEndian.Uint32(buf[:4])
+		if crc == dataDescriptorSignature {
+			if _, err := io.ReadFull(e.r, buf[:4]); err != nil {
+				return unexpectedEOF(err)
+			}
+			crc = binary.LittleEndian.Uint32(buf[:4])
+		}
+		e.hdr.crc32 = crc
+
+		// the sizes are 8 bytes each in zip64 archives
+		sizes := 8
+		if e.hdr.zip64 || compressed >= uint32max {
+			sizes = 16
+		}
+		if _, err := io.ReadFull(e.r, buf[:sizes]); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+
+	if e.crc.Sum32() != e.hdr.crc32 {
+		return zip.ErrChecksum
+	}
+	return io.EOF
+}
+
+// skip moves past the rest of the entry, after which it can't be read
+func (e *zipStreamEntry) skip() error {
+	err := e.discard()
+	e.err = errSuperseded
+	return err
+}
+
+func (e *zipStreamEntry) discard() error {
+	if lr, ok := e.data.(*io.LimitedReader); ok && e.err == nil {
+		// The size is known, so there's no need to decompress the rest
+		if _, err := io.Copy(io.Discard, lr); err != nil {
+			return err
+		}
+		if lr.N > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	_, err := io.Copy(io.Discard, readerFunc(e.read))
+	return err
+}
+
+func (e *zipStreamEntry) Close() error {
+	e.closed = true
+	return nil
+}
+
+// skipEntry moves r past the contents of an entry that wasn't opened
+func skipEntry(r io.Reader, hdr *localHeader, entry *zipStreamEntry) error {
+	if entry != nil {
+		return entry.skip()
+	}
+	if hdr.flags&flagDataDescriptor != 0 {
+		return errStreamUnsupported
+	}
+	_, err := io.CopyN(io.Discard, r, int64(hdr.compSize))
+	return unexpectedEOF(err)
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingReader keeps track of how many bytes have been read,
+// and is an io.ByteReader so that flate doesn't read past the end of its stream
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,197 @@
+package chain_test
+
+import (
+	"archive/tar"
+	stdzip "archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/archive"
+	"github.com/conradludgate/chain/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTar(t *testing.T) {
+	modTime := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	tarCfg := archive.TarConfig{Mode: 0o600, ModTime: modTime, Uname: "chain"}
+	gzip := compress.GZIPConfig{}
+
+	output := bytes.NewBuffer(nil)
+
+	wfs, err := chain.NewWriteBuilder(ToLower).
+		IntoFS(tarCfg.FSWriter).
+		Then(gzip.Compress).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+
+	files := map[string]string{
+		"hello.txt":         "HELLO WORLD",
+		"nested/dir/a.txt":  inputUpper,
+		"nested/goodbye.md": "GOODBYE WORLD",
+	}
+	for name, contents := range files {
+		w, err := wfs.Create(name)
+		require.Nil(t, err)
+		_, err = io.WriteString(w, contents)
+		require.Nil(t, err)
+		require.Nil(t, w.Close())
+	}
+	require.Nil(t, wfs.Close())
+	archived := output.Bytes()
+
+	// check the headers with the standard library
+	r, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(archived))).
+		Finally(gzip.Decompress)
+	require.Nil(t, err)
+	tarR := tar.NewReader(r)
+	for {
+		hdr, err := tarR.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		assert.Contains(t, files, hdr.Name)
+		assert.Equal(t, int64(0o600), hdr.Mode)
+		assert.True(t, modTime.Equal(hdr.ModTime))
+		assert.Equal(t, "chain", hdr.Uname)
+	}
+
+	rfs, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(archived))).
+		Then(gzip.Decompress).
+		AsFS(tarCfg.FSReader).
+		Finally(RemoveXYZ)
+	require.Nil(t, err)
+
+	f, err := rfs.Open("nested/dir/a.txt")
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(f)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	assert.Equal(t, "abcdefghijklmnopqrstuvw...", string(b))
+
+	f, err = rfs.Open("hello.txt")
+	require.Nil(t, err)
+	b, err = ioutil.ReadAll(f)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	assert.Equal(t, "hello world", string(b))
+
+	_, err = rfs.Open("missing.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.Nil(t, rfs.Close())
+}
+
+func writeZip(t *testing.T, files ...string) []byte {
+	zip := archive.ZipConfig{}
+	output := bytes.NewBuffer(nil)
+
+	wfs, err := chain.NewWriteBuilder(ToLower).
+		IntoFS(zip.FSWriter).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	for _, name := range files {
+		w, err := wfs.Create(name)
+		require.Nil(t, err)
+		_, err = io.WriteString(w, strings.Repeat(strings.ToUpper(name), 100))
+		require.Nil(t, err)
+		require.Nil(t, w.Close())
+	}
+	require.Nil(t, wfs.Close())
+	return output.Bytes()
+}
+
+func readFile(rfs chain.ReadFS, name string) (string, error) {
+	f, err := rfs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	return string(b), err
+}
+
+func TestZip_Streaming(t *testing.T) {
+	zip := archive.ZipConfig{Streaming: true}
+	archived := writeZip(t, "a.txt", "dir/b.txt", "c.txt", "d.txt")
+
+	rfs, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(archived))).
+		AsFS(zip.FSReader).
+		Finally(ToUpper)
+	require.Nil(t, err)
+
+	s, err := readFile(rfs, "a.txt")
+	require.Nil(t, err)
+	assert.Equal(t, strings.Repeat("A.TXT", 100), s)
+
+	// open without reading it all, so the next open has to skip the rest
+	f, err := rfs.Open("dir/b.txt")
+	require.Nil(t, err)
+	_, err = f.Read(make([]byte, 10))
+	require.Nil(t, err)
+
+	// c.txt is skipped entirely
+	s, err = readFile(rfs, "d.txt")
+	require.Nil(t, err)
+	assert.Equal(t, strings.Repeat("D.TXT", 100), s)
+
+	// and the rest of dir/b.txt can't be read any more
+	b, err := ioutil.ReadAll(f)
+	assert.ErrorIs(t, err, fs.ErrClosed)
+	assert.Empty(t, b)
+
+	_, err = rfs.Open("a.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	require.Nil(t, rfs.Close())
+}
+
+func TestZip_StreamingStored(t *testing.T) {
+	zip := archive.ZipConfig{Streaming: true}
+	archived, err := ioutil.ReadFile("./example/archive.zip")
+	require.Nil(t, err)
+
+	rfs, err := zip.FSReader(io.NopCloser(bytes.NewReader(archived)))
+	require.Nil(t, err)
+	s, err := readFile(rfs, "hello.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "aGVsbG8gd29ybGQK\n", s)
+
+	i := bytes.Index(archived, []byte("aGVsbG8"))
+	require.NotEqual(t, -1, i)
+	archived[i] = 'b'
+	rfs, err = zip.FSReader(io.NopCloser(bytes.NewReader(archived)))
+	require.Nil(t, err)
+	_, err = readFile(rfs, "hello.txt")
+	assert.Equal(t, stdzip.ErrChecksum, err)
+}
+
+func TestZip_Spill(t *testing.T) {
+	dir := t.TempDir()
+	zip := archive.ZipConfig{MaxMemory: 64, TempDir: dir}
+	archived := writeZip(t, "a.txt", "b.txt")
+
+	rfs, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(archived))).
+		AsFS(zip.FSReader).
+		Finally(ToUpper)
+	require.Nil(t, err)
+
+	spilled, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, spilled, 1)
+
+	s, err := readFile(rfs, "b.txt")
+	require.Nil(t, err)
+	assert.Equal(t, strings.Repeat("B.TXT", 100), s)
+
+	require.Nil(t, rfs.Close())
+	spilled, err = ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, spilled, 0)
+}
@@ -0,0 +1,192 @@
+// Package chaintest implements support for testing implementations of chain stages.
+//
+// Like testing/fstest, the checks return an error describing
+// everything that went wrong rather than taking a *testing.T:
+//
+//	if err := chaintest.TestWriteChain(cfg.Compress); err != nil {
+//		t.Fatal(err)
+//	}
+package chaintest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/conradludgate/chain"
+)
+
+var (
+	errClose = errors.New("chaintest: close failed")
+	errIO    = errors.New("chaintest: I/O failed")
+)
+
+// testData is written through write chains. It's larger than the
+// default block size of most compressors, so it's not all buffered
+var testData = bytes.Repeat([]byte("hello world, chaintest\n"), 1<<16)
+
+// TestWriteChain checks that wc behaves like a stage of a WriterBuilder:
+//
+//   - closing it closes the writer it wraps exactly once, and doesn't write to it afterwards
+//   - an error from closing the writer it wraps is returned from Close
+//   - if building it fails, it returns no writer and leaves closing the writer it wraps to the builder
+func TestWriteChain(wc chain.WriteChain) error {
+	var errs []error
+
+	s := &sink{}
+	if err := s.run(wc); err != nil {
+		errs = append(errs, fmt.Errorf("writing: %w", err))
+	}
+	errs = append(errs, s.check())
+
+	s = &sink{closeErr: errClose}
+	if err := s.run(wc); !errors.Is(err, errClose) {
+		errs = append(errs, fmt.Errorf("closing: expected the error from closing the wrapped writer, got %v", err))
+	}
+
+	s = &sink{writeErr: errIO}
+	w, err := wc(s)
+	if err != nil {
+		if w != nil {
+			errs = append(errs, errors.New("building with a failing writer: returned a writer along with an error"))
+		}
+		if s.closes != 0 {
+			errs = append(errs, errors.New("building with a failing writer: closed the wrapped writer, which is the builder's job"))
+		}
+	} else {
+		w.Write(testData)
+		w.Close()
+		errs = append(errs, s.check())
+	}
+
+	return join(errs)
+}
+
+// TestReadChain checks that rc behaves like a stage of a ReaderBuilder:
+//
+//   - input, a valid stream for rc, can be read through it
+//   - closing it closes the reader it wraps exactly once
+//   - an error from closing the reader it wraps is returned from Close
+//   - if building it fails, it returns no reader and leaves closing the reader it wraps to the builder
+func TestReadChain(rc chain.ReadChain, input []byte) error {
+	var errs []error
+
+	s := &source{r: bytes.NewReader(input)}
+	if err := s.run(rc); err != nil {
+		errs = append(errs, fmt.Errorf("reading: %w", err))
+	}
+	errs = append(errs, s.check())
+
+	s = &source{r: bytes.NewReader(input), closeErr: errClose}
+	if err := s.run(rc); !errors.Is(err, errClose) {
+		errs = append(errs, fmt.Errorf("closing: expected the error from closing the wrapped reader, got %v", err))
+	}
+
+	s = &source{r: errReader{}}
+	r, err := rc(s)
+	if err != nil {
+		if r != nil {
+			errs = append(errs, errors.New("building with a failing reader: returned a reader along with an error"))
+		}
+		if s.closes != 0 {
+			errs = append(errs, errors.New("building with a failing reader: closed the wrapped reader, which is the builder's job"))
+		}
+	} else {
+		io.Copy(io.Discard, r)
+		r.Close()
+		errs = append(errs, s.check())
+	}
+
+	return join(errs)
+}
+
+// sink records how a stage uses the writer it wraps
+type sink struct {
+	bytes.Buffer
+	closes     int
+	lateWrites int
+	closeErr   error
+	writeErr   error
+}
+
+func (s *sink) Write(p []byte) (int, error) {
+	if s.closes > 0 {
+		s.lateWrites++
+	}
+	if s.writeErr != nil {
+		return 0, s.writeErr
+	}
+	return s.Buffer.Write(p)
+}
+
+func (s *sink) Close() error {
+	s.closes++
+	return s.closeErr
+}
+
+func (s *sink) run(wc chain.WriteChain) error {
+	w, err := wc(s)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(testData); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *sink) check() error {
+	var errs []error
+	if s.closes != 1 {
+		errs = append(errs, fmt.Errorf("closing the stage closed the wrapped writer %d times, expected once", s.closes))
+	}
+	if s.lateWrites > 0 {
+		errs = append(errs, errors.New("the stage wrote to the wrapped writer after closing it"))
+	}
+	return join(errs)
+}
+
+// source records how a stage uses the reader it wraps
+type source struct {
+	r        io.Reader
+	closes   int
+	closeErr error
+}
+
+func (s *source) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *source) Close() error {
+	s.closes++
+	return s.closeErr
+}
+
+func (s *source) run(rc chain.ReadChain) error {
+	r, err := rc(s)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		r.Close()
+		return err
+	}
+	return r.Close()
+}
+
+func (s *source) check() error {
+	if s.closes != 1 {
+		return fmt.Errorf("closing the stage closed the wrapped reader %d times, expected once", s.closes)
+	}
+	return nil
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errIO }
+
+func join(errs []error) error {
+	return chain.JoinErrors(errs...)
+}
@@ -0,0 +1,301 @@
+package chaintest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"testing/fstest"
+
+	"github.com/conradludgate/chain"
+)
+
+// testFiles are written to the WriteFS being tested
+var testFiles = map[string][]byte{
+	"hello.txt":        []byte("hello world\n"),
+	"empty.txt":        {},
+	"dir/nested.txt":   []byte("nested file\n"),
+	"dir/sub/deep.txt": bytes.Repeat([]byte("deep file\n"), 1000),
+}
+
+// lastFile is written through a WriterFileBuilder, so it's closed along with the WriteFS
+const lastFile = "dir/last.txt"
+
+// TestFS checks that a WriteFS, and the ReadFS of what was written to it,
+// behave like OS and the archive backends:
+//
+//   - files, including ones in nested directories, can be created and read back
+//   - closing a file and then the file system, as WriteCloser2 and ReadCloser2 do, works,
+//     and the file has finished closing before the file system is closed
+//   - closing files and file systems a second time doesn't panic, and returns nil or fs.ErrClosed
+//   - opening a file that doesn't exist fails with fs.ErrNotExist
+//   - files can be opened and read concurrently
+//   - if the ReadFS is a StatFS and ReadDirFS, it passes fstest.TestFS through chain.ToFS
+//
+// wfs should be empty. If it doesn't create directories itself, as OS doesn't,
+// create each of Dirs in it first.
+// open is called once wfs has been closed, to open the files that were written to it.
+func TestFS(wfs chain.WriteFS, open func() (chain.ReadFS, error)) error {
+	if err := testWriteFS(wfs); err != nil {
+		return fmt.Errorf("writing: %w", err)
+	}
+
+	rfs, err := open()
+	if err != nil {
+		return fmt.Errorf("opening the written files: %w", err)
+	}
+	if err := testReadFS(rfs); err != nil {
+		return fmt.Errorf("reading: %w", err)
+	}
+	return nil
+}
+
+// Dirs returns the directories, as slash-separated paths, that TestFS writes files in
+func Dirs() []string {
+	seen := map[string]bool{".": true}
+	var dirs []string
+	for _, name := range append(sortedNames(), lastFile) {
+		for dir := path.Dir(name); !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+func testWriteFS(wfs chain.WriteFS) error {
+	var errs []error
+	for _, name := range sortedNames() {
+		f, err := wfs.Create(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("create %s: %w", name, err))
+			continue
+		}
+		if _, err := f.Write(testFiles[name]); err != nil {
+			errs = append(errs, fmt.Errorf("write %s: %w", name, err))
+		}
+		if err := f.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close %s: %w", name, err))
+		}
+		if err := closeTwice(f); err != nil {
+			errs = append(errs, fmt.Errorf("close %s again: %w", name, err))
+		}
+	}
+
+	// this closes the file, then the file system
+	order := &closeOrder{}
+	f, err := chain.NewWriteBuilder(passthrough).Create(lastFile).WritingToFS(orderedWriteFS{wfs, order})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("create %s: %w", lastFile, err))
+		return join(errs)
+	}
+	if _, err := f.Write(lastContents()); err != nil {
+		errs = append(errs, fmt.Errorf("write %s: %w", lastFile, err))
+	}
+	if err := f.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close %s and the file system: %w", lastFile, err))
+	}
+	if err := order.check(); err != nil {
+		errs = append(errs, fmt.Errorf("close %s and the file system: %w", lastFile, err))
+	}
+	if err := closeTwice(wfs); err != nil {
+		errs = append(errs, fmt.Errorf("close the file system again: %w", err))
+	}
+	return join(errs)
+}
+
+func testReadFS(rfs chain.ReadFS) error {
+	var errs []error
+	for _, name := range sortedNames() {
+		errs = append(errs, checkFile(rfs, name, testFiles[name]))
+	}
+
+	_, err := rfs.Open("missing.txt")
+	if !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, fmt.Errorf("open missing.txt: expected fs.ErrNotExist, got %v", err))
+	}
+
+	// all the files at once
+	var wg sync.WaitGroup
+	concurrent := make([]error, len(testFiles))
+	for i, name := range sortedNames() {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			if err := checkFile(rfs, name, testFiles[name]); err != nil {
+				concurrent[i] = fmt.Errorf("concurrently: %w", err)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	errs = append(errs, concurrent...)
+
+	if _, ok := rfs.(chain.StatFS); ok {
+		if _, ok := rfs.(chain.ReadDirFS); ok {
+			names := append(sortedNames(), lastFile)
+			if err := fstest.TestFS(chain.ToFS(rfs), names...); err != nil {
+				errs = append(errs, fmt.Errorf("as an fs.FS: %w", err))
+			}
+		}
+	}
+
+	// this closes the file, then the file system
+	order := &closeOrder{}
+	r, err := chain.ReadingFromFS(orderedReadFS{rfs, order}).Open(lastFile).Finally(passthroughReader)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("open %s: %w", lastFile, err))
+		return join(errs)
+	}
+	if b, err := io.ReadAll(r); err != nil {
+		errs = append(errs, fmt.Errorf("read %s: %w", lastFile, err))
+	} else if !bytes.Equal(b, lastContents()) {
+		errs = append(errs, fmt.Errorf("read %s: got %q, expected %q", lastFile, truncate(b), lastContents()))
+	}
+	if err := r.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close %s and the file system: %w", lastFile, err))
+	}
+	if err := order.check(); err != nil {
+		errs = append(errs, fmt.Errorf("close %s and the file system: %w", lastFile, err))
+	}
+	if err := closeTwice(rfs); err != nil {
+		errs = append(errs, fmt.Errorf("close the file system again: %w", err))
+	}
+	return join(errs)
+}
+
+// checkFile opens name and checks it contains expected
+func checkFile(rfs chain.ReadFS, name string, expected []byte) error {
+	f, err := rfs.Open(name)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", name, err)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", name, err)
+	}
+	if err := closeTwice(f); err != nil {
+		return fmt.Errorf("close %s again: %w", name, err)
+	}
+	if !bytes.Equal(b, expected) {
+		return fmt.Errorf("read %s: got %q, expected %q", name, truncate(b), truncate(expected))
+	}
+	return nil
+}
+
+// closeTwice closes c, which has already been closed.
+// It must not panic, and either succeed again or return fs.ErrClosed
+func closeTwice(c io.Closer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panicked: %v", r)
+		}
+	}()
+	if err := c.Close(); err != nil && !errors.Is(err, fs.ErrClosed) {
+		return fmt.Errorf("expected nil or fs.ErrClosed, got %w", err)
+	}
+	return nil
+}
+
+// closeOrder records the closing of a file and the file system it's in
+type closeOrder struct {
+	events []string
+}
+
+func (o *closeOrder) check() error {
+	expected := []string{"file closed", "file system closing"}
+	if fmt.Sprint(o.events) != fmt.Sprint(expected) {
+		return fmt.Errorf("expected %q, got %q", expected, o.events)
+	}
+	return nil
+}
+
+type orderedWriteFS struct {
+	chain.WriteFS
+	order *closeOrder
+}
+
+func (fs orderedWriteFS) Create(name string) (io.WriteCloser, error) {
+	w, err := fs.WriteFS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return orderedWriter{w, fs.order}, nil
+}
+
+func (fs orderedWriteFS) Close() error {
+	fs.order.events = append(fs.order.events, "file system closing")
+	return fs.WriteFS.Close()
+}
+
+type orderedWriter struct {
+	io.WriteCloser
+	order *closeOrder
+}
+
+func (w orderedWriter) Close() error {
+	err := w.WriteCloser.Close()
+	w.order.events = append(w.order.events, "file closed")
+	return err
+}
+
+type orderedReadFS struct {
+	chain.ReadFS
+	order *closeOrder
+}
+
+func (fs orderedReadFS) Open(name string) (io.ReadCloser, error) {
+	r, err := fs.ReadFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return orderedReader{r, fs.order}, nil
+}
+
+func (fs orderedReadFS) Close() error {
+	fs.order.events = append(fs.order.events, "file system closing")
+	return fs.ReadFS.Close()
+}
+
+type orderedReader struct {
+	io.ReadCloser
+	order *closeOrder
+}
+
+func (r orderedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.order.events = append(r.order.events, "file closed")
+	return err
+}
+
+func sortedNames() []string {
+	names := make([]string, 0, len(testFiles))
+	for name := range testFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lastContents() []byte {
+	return []byte("written through a chain\n")
+}
+
+func truncate(b []byte) []byte {
+	if len(b) > 32 {
+		return b[:32]
+	}
+	return b
+}
+
+func passthrough(w io.WriteCloser) (io.WriteCloser, error) { return w, nil }
+
+func passthroughReader(r io.ReadCloser) (io.ReadCloser, error) { return r, nil }
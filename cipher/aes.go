@@ -1,37 +1,103 @@
 package cipher
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"io"
 
 	"github.com/conradludgate/chain"
 )
 
+// AESConfig encrypts streams with AES in OFB mode.
+//
+// By default, Encrypt generates a random IV and writes it in a small header
+// ahead of the ciphertext, which Decrypt reads back. Set Raw to use IV as is,
+// without any header. This is how streams were encrypted before headers were added.
+//
+// Decrypt falls back to Raw for streams that don't start with a header,
+// so streams encrypted before headers were added can still be decrypted with IV.
 type AESConfig struct {
 	Key []byte
 	IV  [aes.BlockSize]byte
+	Raw bool
 }
 
 func (cfg AESConfig) Stream() (cipher.Stream, error) {
+	return cfg.stream(cfg.IV[:])
+}
+
+func (cfg AESConfig) stream(iv []byte) (cipher.Stream, error) {
 	block, err := aes.NewCipher(cfg.Key)
 	if err != nil {
 		return nil, err
 	}
-	var iv [aes.BlockSize]byte
-	copy(iv[:], cfg.IV[:])
-	return cipher.NewOFB(block, iv[:]), nil
+	return cipher.NewOFB(block, iv), nil
 }
 
 func (cfg AESConfig) Encrypt(w io.WriteCloser) (io.WriteCloser, error) {
-	s, err := cfg.Stream()
-	return cipher.StreamWriter{S: s, W: w}, err
+	if cfg.Raw {
+		s, err := cfg.Stream()
+		if err != nil {
+			return nil, err
+		}
+		return cipher.StreamWriter{S: s, W: w}, nil
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	s, err := cfg.stream(iv)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeHeader(w, AlgorithmAESOFB, iv); err != nil {
+		return nil, err
+	}
+	return cipher.StreamWriter{S: s, W: w}, nil
 }
 
 func (cfg AESConfig) Decrypt(r io.ReadCloser) (io.ReadCloser, error) {
-	s, err := cfg.Stream()
+	if cfg.Raw {
+		s, err := cfg.Stream()
+		if err != nil {
+			return nil, err
+		}
+		return decrypt(s, r, r), nil
+	}
+
+	// streams encrypted before headers were added start straight away with the
+	// ciphertext, so if there's no header, decrypt it with IV as if Raw were set
+	magic := make([]byte, len(headerMagic))
+	n, err := io.ReadFull(r, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	read := io.MultiReader(bytes.NewReader(magic[:n]), r)
+	if !bytes.Equal(magic[:n], headerMagic[:]) {
+		s, err := cfg.Stream()
+		if err != nil {
+			return nil, err
+		}
+		return decrypt(s, read, r), nil
+	}
+
+	iv, err := readHeader(read, AlgorithmAESOFB, aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	s, err := cfg.stream(iv)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(s, read, r), nil
+}
+
+func decrypt(s cipher.Stream, r io.Reader, c io.Closer) io.ReadCloser {
 	return chain.ReadCloser{
 		Reader: cipher.StreamReader{S: s, R: r},
-		Closer: r,
-	}, err
+		Closer: c,
+	}
 }
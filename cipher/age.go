@@ -0,0 +1,57 @@
+package cipher
+
+import (
+	"io"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/conradludgate/chain"
+)
+
+// AgeConfig encrypts streams in the age file format (https://age-encryption.org),
+// so they can be read and written by the age CLI.
+//
+// Encrypt encrypts to every one of Recipients, such as an *age.X25519Recipient
+// or *age.ScryptRecipient. Decrypt decrypts with the first of Identities that matches,
+// such as an *age.X25519Identity or *age.ScryptIdentity.
+// Set Armor to use the ASCII armored format, like age --armor.
+type AgeConfig struct {
+	Recipients []age.Recipient
+	Identities []age.Identity
+	Armor      bool
+}
+
+func (cfg AgeConfig) Encrypt(w io.WriteCloser) (io.WriteCloser, error) {
+	out := w
+	if cfg.Armor {
+		out = chain.WriteCloser2{
+			WriteCloser: armor.NewWriter(w),
+			Closer:      w,
+		}
+	}
+
+	ew, err := age.Encrypt(out, cfg.Recipients...)
+	if err != nil {
+		return nil, err
+	}
+	return chain.WriteCloser2{
+		WriteCloser: ew,
+		Closer:      out,
+	}, nil
+}
+
+func (cfg AgeConfig) Decrypt(r io.ReadCloser) (io.ReadCloser, error) {
+	var in io.Reader = r
+	if cfg.Armor {
+		in = armor.NewReader(r)
+	}
+
+	dr, err := age.Decrypt(in, cfg.Identities...)
+	if err != nil {
+		return nil, err
+	}
+	return chain.ReadCloser{
+		Reader: dr,
+		Closer: r,
+	}, nil
+}
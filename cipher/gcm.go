@@ -0,0 +1,292 @@
+package cipher
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// DefaultChunkSize is the amount of plaintext sealed into
+	// each chunk when GCMConfig.ChunkSize is not set
+	DefaultChunkSize = 64 * 1024
+
+	// MaxChunkSize is the largest chunk size a GCM stream
+	// is allowed to declare in its header
+	MaxChunkSize = 16 * 1024 * 1024
+
+	gcmPrefixSize = 7
+	gcmHeaderSize = gcmPrefixSize + 4
+)
+
+var (
+	// ErrAuthentication is returned when a chunk of a GCM stream
+	// fails to authenticate. This happens if the ciphertext was
+	// tampered with, reordered or truncated at a chunk boundary.
+	ErrAuthentication = errors.New("cipher: message authentication failed")
+
+	// ErrTruncated is returned when a GCM stream ends before
+	// its header or final chunk could be read in full
+	ErrTruncated = errors.New("cipher: ciphertext truncated")
+
+	// ErrInvalidHeader is returned when a stream header
+	// is malformed or unsupported
+	ErrInvalidHeader = errors.New("cipher: invalid header")
+
+	errWriteClosed = errors.New("cipher: write to closed stream")
+)
+
+// GCMConfig encrypts streams with AES-GCM using the STREAM
+// construction. The plaintext is split into chunks of ChunkSize bytes,
+// each sealed with a nonce made of a random per-stream prefix,
+// a big endian chunk counter and a flag marking the final chunk.
+//
+// This means that any tampering, reordering or truncation of the
+// ciphertext is detected by the reader, which will return an error
+// rather than release unauthenticated plaintext.
+type GCMConfig struct {
+	Key       []byte
+	ChunkSize int
+}
+
+// AEAD returns the AES-GCM cipher for the configured key
+func (cfg GCMConfig) AEAD() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (cfg GCMConfig) chunkSize() int {
+	if cfg.ChunkSize <= 0 {
+		return DefaultChunkSize
+	}
+	return cfg.ChunkSize
+}
+
+// Encrypt writes the stream header to w and returns a writer
+// that seals everything written to it. The final chunk is only
+// written once the returned writer is closed.
+func (cfg GCMConfig) Encrypt(w io.WriteCloser) (io.WriteCloser, error) {
+	chunkSize := cfg.chunkSize()
+	if chunkSize > MaxChunkSize {
+		return nil, ErrInvalidHeader
+	}
+
+	aead, err := cfg.AEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, gcmHeaderSize)
+	if _, err := io.ReadFull(rand.Reader, header[:gcmPrefixSize]); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(header[gcmPrefixSize:], uint32(chunkSize))
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &gcmWriter{
+		w:      w,
+		stream: newGCMStream(aead, header),
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// Decrypt reads the stream header from r and returns a reader
+// that only releases plaintext once each chunk has been authenticated.
+func (cfg GCMConfig) Decrypt(r io.ReadCloser) (io.ReadCloser, error) {
+	aead, err := cfg.AEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, gcmHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrTruncated
+		}
+		return nil, err
+	}
+	chunkSize := int(binary.BigEndian.Uint32(header[gcmPrefixSize:]))
+	if chunkSize <= 0 || chunkSize > MaxChunkSize {
+		return nil, ErrInvalidHeader
+	}
+
+	return &gcmReader{
+		r:      r,
+		stream: newGCMStream(aead, header),
+		// one extra byte is read ahead to know if a chunk is the final one
+		in:  make([]byte, chunkSize+aead.Overhead()+1),
+		out: make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// gcmStream tracks the nonce for each chunk.
+// The header is authenticated as additional data of every chunk.
+type gcmStream struct {
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint32
+	done    bool
+}
+
+func newGCMStream(aead cipher.AEAD, header []byte) gcmStream {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, header[:gcmPrefixSize])
+	return gcmStream{
+		aead:   aead,
+		header: header,
+		nonce:  nonce,
+	}
+}
+
+func (s *gcmStream) next(last bool) ([]byte, error) {
+	if s.done {
+		return nil, ErrTruncated
+	}
+	n := len(s.nonce)
+	binary.BigEndian.PutUint32(s.nonce[n-5:n-1], s.counter)
+	if last {
+		s.nonce[n-1] = 1
+		s.done = true
+	}
+
+	s.counter++
+	if s.counter == 0 {
+		return nil, errors.New("cipher: too many chunks in stream")
+	}
+	return s.nonce, nil
+}
+
+type gcmWriter struct {
+	w      io.WriteCloser
+	stream gcmStream
+	buf    []byte
+	out    []byte
+	err    error
+}
+
+func (w *gcmWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.stream.done {
+		return 0, errWriteClosed
+	}
+	for len(p) > 0 {
+		// Only seal a full chunk once we know more data follows,
+		// so that Close can always seal the final chunk
+		if len(w.buf) == cap(w.buf) {
+			if w.err = w.flush(false); w.err != nil {
+				return n, w.err
+			}
+		}
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (w *gcmWriter) flush(last bool) error {
+	nonce, err := w.stream.next(last)
+	if err != nil {
+		return err
+	}
+	w.out = w.stream.aead.Seal(w.out[:0], nonce, w.buf, w.stream.header)
+	w.buf = w.buf[:0]
+	_, err = w.w.Write(w.out)
+	return err
+}
+
+func (w *gcmWriter) Close() error {
+	if w.stream.done {
+		return nil
+	}
+	err1 := w.err
+	if err1 == nil {
+		err1 = w.flush(true)
+	}
+	w.stream.done = true
+	err2 := w.w.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+type gcmReader struct {
+	r       io.ReadCloser
+	stream  gcmStream
+	in      []byte
+	pending int
+	out     []byte
+	plain   []byte
+	err     error
+}
+
+func (r *gcmReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *gcmReader) next() error {
+	if r.stream.done {
+		return io.EOF
+	}
+
+	n, err := io.ReadFull(r.r, r.in[r.pending:])
+	n += r.pending
+	last := false
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	}
+
+	chunk := r.in[:n]
+	if !last {
+		chunk = r.in[:n-1]
+	}
+	if len(chunk) < r.stream.aead.Overhead() {
+		return ErrTruncated
+	}
+
+	nonce, err := r.stream.next(last)
+	if err != nil {
+		return err
+	}
+	plain, err := r.stream.aead.Open(r.out[:0], nonce, chunk, r.stream.header)
+	if err != nil {
+		return ErrAuthentication
+	}
+	r.plain = plain
+
+	if !last {
+		// The read ahead byte is the start of the next chunk
+		r.in[0] = r.in[n-1]
+		r.pending = 1
+	}
+	return nil
+}
+
+func (r *gcmReader) Close() error {
+	return r.r.Close()
+}
@@ -0,0 +1,59 @@
+package cipher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Algorithm identifies the cipher used to encrypt a stream
+// in its header
+type Algorithm uint8
+
+const (
+	// AlgorithmAESOFB is AES in OFB mode, as used by AESConfig
+	AlgorithmAESOFB Algorithm = 1
+
+	// AlgorithmScryptAESGCM is a GCM stream keyed by scrypt,
+	// as used by PassphraseConfig
+	AlgorithmScryptAESGCM Algorithm = 2
+)
+
+const headerVersion = 1
+
+var headerMagic = [4]byte{'c', 'h', 'n', 'c'}
+
+// writeHeader writes the magic, version and algorithm id,
+// followed by the algorithm specific body
+func writeHeader(w io.Writer, alg Algorithm, body []byte) error {
+	header := make([]byte, 0, len(headerMagic)+2+len(body))
+	header = append(header, headerMagic[:]...)
+	header = append(header, headerVersion, byte(alg))
+	header = append(header, body...)
+	_, err := w.Write(header)
+	return err
+}
+
+// readHeader reads a header written by writeHeader, checking it is for
+// the given algorithm, and returns the algorithm specific body
+func readHeader(r io.Reader, alg Algorithm, size int) ([]byte, error) {
+	header := make([]byte, len(headerMagic)+2+size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrTruncated
+		}
+		return nil, err
+	}
+
+	if string(header[:len(headerMagic)]) != string(headerMagic[:]) {
+		return nil, ErrInvalidHeader
+	}
+	header = header[len(headerMagic):]
+	if header[0] != headerVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, header[0])
+	}
+	if Algorithm(header[1]) != alg {
+		return nil, fmt.Errorf("%w: unexpected algorithm %d", ErrInvalidHeader, header[1])
+	}
+	return header[2:], nil
+}
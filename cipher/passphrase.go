@@ -0,0 +1,122 @@
+package cipher
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// DefaultScryptLogN is the scrypt work factor, as a power of 2,
+	// used when PassphraseConfig.LogN is not set
+	DefaultScryptLogN = 15
+
+	// MaxScryptLogN is the largest work factor Decrypt will accept
+	// from a header, so that a malicious header can't exhaust memory
+	MaxScryptLogN = 22
+
+	// MaxScryptMemory is the most memory, 128·R·2^LogN bytes, that Decrypt will let
+	// a header's scrypt parameters use. It is what MaxScryptLogN uses with the default R
+	MaxScryptMemory = 128 * 8 << MaxScryptLogN
+
+	// MaxScryptP is the largest parallelism Decrypt will accept from a header.
+	// scrypt runs P times over, so it is capped to bound the time a header can ask for
+	MaxScryptP = 16
+
+	scryptSaltSize = 16
+	scryptKeySize  = 32
+)
+
+// PassphraseConfig encrypts streams with a key derived from a passphrase
+// using scrypt. The salt and scrypt parameters are written in the stream header,
+// so Decrypt only needs the passphrase. The derived key is used
+// to encrypt the rest of the stream as in GCMConfig.
+type PassphraseConfig struct {
+	Passphrase []byte
+	ChunkSize  int
+
+	// scrypt cost parameters. LogN defaults to DefaultScryptLogN,
+	// R defaults to 8 and P defaults to 1
+	LogN uint8
+	R    uint8
+	P    uint8
+}
+
+func (cfg PassphraseConfig) params() (logN, r, p uint8) {
+	logN, r, p = cfg.LogN, cfg.R, cfg.P
+	if logN == 0 {
+		logN = DefaultScryptLogN
+	}
+	if r == 0 {
+		r = 8
+	}
+	if p == 0 {
+		p = 1
+	}
+	return logN, r, p
+}
+
+// checkParams checks the scrypt parameters are in range, so that they can't exhaust memory
+func checkParams(logN, r, p uint8) error {
+	if logN == 0 || logN > MaxScryptLogN {
+		return fmt.Errorf("%w: scrypt work factor 2^%d out of range", ErrInvalidHeader, logN)
+	}
+	if r == 0 || 128*uint64(r)<<logN > MaxScryptMemory {
+		return fmt.Errorf("%w: scrypt block size %d out of range for work factor 2^%d", ErrInvalidHeader, r, logN)
+	}
+	if p == 0 || p > MaxScryptP {
+		return fmt.Errorf("%w: scrypt parallelism %d out of range", ErrInvalidHeader, p)
+	}
+	return nil
+}
+
+func (cfg PassphraseConfig) key(salt []byte, logN, r, p uint8) (GCMConfig, error) {
+	key, err := scrypt.Key(cfg.Passphrase, salt, 1<<logN, int(r), int(p), scryptKeySize)
+	return GCMConfig{Key: key, ChunkSize: cfg.ChunkSize}, err
+}
+
+// Encrypt generates a random salt, derives the key
+// and writes the header before encrypting the stream
+func (cfg PassphraseConfig) Encrypt(w io.WriteCloser) (io.WriteCloser, error) {
+	logN, r, p := cfg.params()
+	if err := checkParams(logN, r, p); err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, scryptSaltSize, scryptSaltSize+3)
+	if _, err := io.ReadFull(rand.Reader, body); err != nil {
+		return nil, err
+	}
+	body = append(body, logN, r, p)
+
+	gcm, err := cfg.key(body[:scryptSaltSize], logN, r, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeHeader(w, AlgorithmScryptAESGCM, body); err != nil {
+		return nil, err
+	}
+	return gcm.Encrypt(w)
+}
+
+// Decrypt reads the salt and scrypt parameters from the header,
+// derives the key and decrypts the stream
+func (cfg PassphraseConfig) Decrypt(r io.ReadCloser) (io.ReadCloser, error) {
+	body, err := readHeader(r, AlgorithmScryptAESGCM, scryptSaltSize+3)
+	if err != nil {
+		return nil, err
+	}
+
+	logN, blockSize, p := body[scryptSaltSize], body[scryptSaltSize+1], body[scryptSaltSize+2]
+	if err := checkParams(logN, blockSize, p); err != nil {
+		return nil, err
+	}
+
+	gcm, err := cfg.key(body[:scryptSaltSize], logN, blockSize, p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	return gcm.Decrypt(r)
+}
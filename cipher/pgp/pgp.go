@@ -0,0 +1,296 @@
+// Package pgp provides OpenPGP encryption and signing stages
+package pgp
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/conradludgate/chain"
+)
+
+var (
+	// ErrUnsigned is returned at the end of a message
+	// that was required to be signed but wasn't
+	ErrUnsigned = errors.New("pgp: message is not signed")
+
+	// ErrUnknownSigner is returned at the end of a signed message
+	// when the signing key is not in the keyring
+	ErrUnknownSigner = pgperrors.ErrUnknownIssuer
+
+	// ErrNoKey is returned when encrypting without
+	// any recipients or passphrase, or signing without a signer
+	ErrNoKey = errors.New("pgp: no key provided")
+
+	errPassphrase = errors.New("pgp: incorrect passphrase")
+	errClosed     = errors.New("pgp: read from closed message")
+)
+
+// Config configures OpenPGP messages.
+//
+// On the write side, Encrypt encrypts to Recipients, or with Passphrase if
+// there are no recipients. If Signer is set, the message is signed too.
+// Sign and DetachSign sign messages without encrypting them.
+//
+// On the read side, Decrypt decrypts using the private keys in Keyring, or Passphrase,
+// and checks any signature against the public keys in Keyring.
+// Verification failures are returned by Read once the end of the message is reached,
+// so the contents must be read in full before they can be trusted.
+type Config struct {
+	Recipients openpgp.EntityList
+	Passphrase []byte
+	Signer     *openpgp.Entity
+	Keyring    openpgp.KeyRing
+
+	// RequireSignature makes Decrypt return ErrUnsigned
+	// for messages that are not signed
+	RequireSignature bool
+
+	// SignatureOut is where DetachSign writes the detached signature
+	SignatureOut io.Writer
+	// SignatureIn is where VerifyDetached reads the detached signature from
+	SignatureIn io.Reader
+
+	Hints  *openpgp.FileHints
+	Packet *packet.Config
+}
+
+// Encrypt encrypts, and optionally signs, everything written to it
+func (cfg Config) Encrypt(w io.WriteCloser) (io.WriteCloser, error) {
+	var pt io.WriteCloser
+	var err error
+	switch {
+	case len(cfg.Recipients) > 0:
+		pt, err = openpgp.Encrypt(w, cfg.Recipients, cfg.Signer, cfg.Hints, cfg.Packet)
+	case cfg.Passphrase != nil:
+		if cfg.Signer != nil {
+			return nil, errors.New("pgp: symmetrically encrypted messages can't be signed")
+		}
+		pt, err = openpgp.SymmetricallyEncrypt(w, cfg.Passphrase, cfg.Hints, cfg.Packet)
+	default:
+		return nil, ErrNoKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return chain.WriteCloser2{WriteCloser: pt, Closer: w}, nil
+}
+
+// Sign writes an inline signed message, without encryption
+func (cfg Config) Sign(w io.WriteCloser) (io.WriteCloser, error) {
+	if cfg.Signer == nil {
+		return nil, ErrNoKey
+	}
+	pt, err := openpgp.Sign(w, cfg.Signer, cfg.Hints, cfg.Packet)
+	if err != nil {
+		return nil, err
+	}
+	return chain.WriteCloser2{WriteCloser: pt, Closer: w}, nil
+}
+
+// DetachSign passes everything written to it through unchanged,
+// and writes a binary signature of it to SignatureOut once closed
+func (cfg Config) DetachSign(w io.WriteCloser) (io.WriteCloser, error) {
+	if cfg.Signer == nil || cfg.SignatureOut == nil {
+		return nil, ErrNoKey
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := openpgp.DetachSign(cfg.SignatureOut, cfg.Signer, pr, cfg.Packet)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	return &detachSigner{w: w, pw: pw, done: done}, nil
+}
+
+type detachSigner struct {
+	w    io.WriteCloser
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (s *detachSigner) Write(p []byte) (int, error) {
+	if _, err := s.pw.Write(p); err != nil {
+		return 0, err
+	}
+	return s.w.Write(p)
+}
+
+func (s *detachSigner) Close() error {
+	if s.done == nil {
+		return nil
+	}
+	s.pw.Close()
+	err1 := <-s.done
+	s.done = nil
+	err2 := s.w.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+func (cfg Config) keyring() openpgp.KeyRing {
+	if cfg.Keyring == nil {
+		return openpgp.EntityList(nil)
+	}
+	return cfg.Keyring
+}
+
+// prompt offers Passphrase once, either for symmetric decryption
+// or to unlock encrypted private keys in the keyring
+func (cfg Config) prompt() openpgp.PromptFunction {
+	tried := false
+	return func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if tried || cfg.Passphrase == nil {
+			return nil, errPassphrase
+		}
+		tried = true
+		if symmetric {
+			return cfg.Passphrase, nil
+		}
+		for _, k := range keys {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				_ = k.PrivateKey.Decrypt(cfg.Passphrase)
+			}
+		}
+		return nil, nil
+	}
+}
+
+// Decrypt reads an OpenPGP message, which may be encrypted, signed, or both.
+// If the message is signed, Read returns an error instead of io.EOF
+// if the signature doesn't verify.
+func (cfg Config) Decrypt(r io.ReadCloser) (io.ReadCloser, error) {
+	md, err := openpgp.ReadMessage(r, cfg.keyring(), cfg.prompt(), cfg.Packet)
+	if err != nil {
+		return nil, err
+	}
+	return &messageReader{
+		md:       md,
+		r:        r,
+		required: cfg.RequireSignature,
+	}, nil
+}
+
+// Verify is the same as Decrypt, but requires the message to be signed
+func (cfg Config) Verify(r io.ReadCloser) (io.ReadCloser, error) {
+	cfg.RequireSignature = true
+	return cfg.Decrypt(r)
+}
+
+type messageReader struct {
+	md       *openpgp.MessageDetails
+	r        io.ReadCloser
+	required bool
+	err      error
+}
+
+func (m *messageReader) Read(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	n, err := m.md.UnverifiedBody.Read(p)
+	if errors.Is(err, io.EOF) {
+		err = m.verify()
+	}
+	m.err = err
+	return n, err
+}
+
+func (m *messageReader) verify() error {
+	switch {
+	case !m.md.IsSigned:
+		if m.required {
+			return ErrUnsigned
+		}
+	case m.md.SignedBy == nil:
+		return ErrUnknownSigner
+	case m.md.SignatureError != nil:
+		return m.md.SignatureError
+	}
+	return io.EOF
+}
+
+func (m *messageReader) Close() error {
+	if m.err == nil {
+		m.err = errClosed
+	}
+	return m.r.Close()
+}
+
+// VerifyDetached passes the data read through it unchanged, checking it against the
+// detached signature in SignatureIn. Read returns an error instead of io.EOF
+// if the signature doesn't verify.
+func (cfg Config) VerifyDetached(r io.ReadCloser) (io.ReadCloser, error) {
+	if cfg.SignatureIn == nil {
+		return nil, ErrUnsigned
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := openpgp.CheckDetachedSignature(cfg.keyring(), pr, cfg.SignatureIn, cfg.Packet)
+		if err == nil {
+			// make sure all of the data was checked
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	return &detachVerifier{r: r, pw: pw, done: done}, nil
+}
+
+type detachVerifier struct {
+	r    io.ReadCloser
+	pw   *io.PipeWriter
+	done chan error
+	err  error
+}
+
+func (v *detachVerifier) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.r.Read(p)
+	if n > 0 {
+		if _, werr := v.pw.Write(p[:n]); werr != nil {
+			err = v.wait(werr)
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		v.pw.Close()
+		err = v.wait(io.EOF)
+	}
+	v.err = err
+	return n, err
+}
+
+// wait returns the verification result,
+// or fallback if the signature was valid
+func (v *detachVerifier) wait(fallback error) error {
+	if v.done == nil {
+		return fallback
+	}
+	err := <-v.done
+	v.done = nil
+	if err != nil {
+		return err
+	}
+	return fallback
+}
+
+func (v *detachVerifier) Close() error {
+	v.pw.CloseWithError(errClosed)
+	_ = v.wait(nil)
+	if v.err == nil {
+		v.err = errClosed
+	}
+	return v.r.Close()
+}
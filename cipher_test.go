@@ -0,0 +1,319 @@
+package chain_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/archive"
+	"github.com/conradludgate/chain/cipher"
+	"github.com/conradludgate/chain/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encrypt writes input through wc, and returns what it wrote
+func encrypt(t *testing.T, wc chain.WriteChain, input string) []byte {
+	output := bytes.NewBuffer(nil)
+
+	w, err := chain.NewWriteBuilder(wc).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, input)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	return output.Bytes()
+}
+
+// decrypt reads all of input through rc
+func decrypt(rc chain.ReadChain, input []byte) ([]byte, error) {
+	r, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(input))).
+		Finally(rc)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func TestGCM(t *testing.T) {
+	key, err := hex.DecodeString("6368616e676520746869732070617373")
+	require.Nil(t, err)
+	gcm := cipher.GCMConfig{Key: key}
+	gzip := compress.GZIPConfig{}
+
+	output := bytes.NewBuffer(nil)
+
+	w, err := chain.NewWriteBuilder(gcm.Encrypt).
+		Then(gzip.Compress).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, "hello world")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	r, err := chain.ReadingFrom(io.NopCloser(output)).
+		Then(gzip.Decompress).
+		Finally(gcm.Decrypt)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+
+	assert.Equal(t, "hello world", string(b))
+}
+
+func TestGCM_Chunks(t *testing.T) {
+	key, err := hex.DecodeString("6368616e676520746869732070617373")
+	require.Nil(t, err)
+	gcm := cipher.GCMConfig{Key: key, ChunkSize: 4}
+
+	for _, input := range []string{"", "abc", "abcd", "abcdefgh", inputLower} {
+		b, err := decrypt(gcm.Decrypt, encrypt(t, gcm.Encrypt, input))
+		require.Nil(t, err)
+		assert.Equal(t, input, string(b))
+	}
+}
+
+func TestGCM_Tampered(t *testing.T) {
+	key, err := hex.DecodeString("6368616e676520746869732070617373")
+	require.Nil(t, err)
+	gcm := cipher.GCMConfig{Key: key, ChunkSize: 4}
+
+	ciphertext := encrypt(t, gcm.Encrypt, inputLower)
+	chunk := 4 + 16
+	header := len(ciphertext) - (len(inputLower)/4+1)*chunk
+
+	t.Run("flipped bit", func(t *testing.T) {
+		c := append([]byte(nil), ciphertext...)
+		c[len(c)-1] ^= 1
+		_, err := decrypt(gcm.Decrypt, c)
+		assert.Equal(t, cipher.ErrAuthentication, err)
+	})
+
+	t.Run("modified header", func(t *testing.T) {
+		c := append([]byte(nil), ciphertext...)
+		c[0] ^= 1
+		_, err := decrypt(gcm.Decrypt, c)
+		assert.Equal(t, cipher.ErrAuthentication, err)
+	})
+
+	t.Run("reordered", func(t *testing.T) {
+		c := append([]byte(nil), ciphertext[:header]...)
+		c = append(c, ciphertext[header+chunk:header+2*chunk]...)
+		c = append(c, ciphertext[header:header+chunk]...)
+		c = append(c, ciphertext[header+2*chunk:]...)
+		_, err := decrypt(gcm.Decrypt, c)
+		assert.Equal(t, cipher.ErrAuthentication, err)
+	})
+
+	t.Run("truncated at chunk boundary", func(t *testing.T) {
+		_, err := decrypt(gcm.Decrypt, ciphertext[:header+2*chunk])
+		assert.Equal(t, cipher.ErrAuthentication, err)
+	})
+
+	t.Run("truncated mid chunk", func(t *testing.T) {
+		_, err := decrypt(gcm.Decrypt, ciphertext[:len(ciphertext)-1])
+		assert.Equal(t, cipher.ErrAuthentication, err)
+	})
+
+	t.Run("truncated header", func(t *testing.T) {
+		_, err := decrypt(gcm.Decrypt, ciphertext[:3])
+		assert.ErrorIs(t, err, cipher.ErrTruncated)
+	})
+
+	t.Run("trailing data", func(t *testing.T) {
+		c := append(append([]byte(nil), ciphertext...), ciphertext[header:header+chunk]...)
+		_, err := decrypt(gcm.Decrypt, c)
+		assert.Equal(t, cipher.ErrAuthentication, err)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, err := decrypt(cipher.GCMConfig{Key: []byte(strings.Repeat("k", 16))}.Decrypt, ciphertext)
+		assert.Equal(t, cipher.ErrAuthentication, err)
+	})
+}
+
+func TestAES_RandomIV(t *testing.T) {
+	key, err := hex.DecodeString("6368616e676520746869732070617373")
+	require.Nil(t, err)
+	aes := cipher.AESConfig{Key: key}
+
+	c1 := encrypt(t, aes.Encrypt, "hello world")
+	c2 := encrypt(t, aes.Encrypt, "hello world")
+	assert.NotEqual(t, c1, c2)
+
+	for _, c := range [][]byte{c1, c2} {
+		b, err := decrypt(aes.Decrypt, c)
+		require.Nil(t, err)
+		assert.Equal(t, "hello world", string(b))
+	}
+
+	_, err = decrypt(aes.Decrypt, c1[:10])
+	assert.ErrorIs(t, err, cipher.ErrTruncated)
+}
+
+func TestAES_Raw(t *testing.T) {
+	key, err := hex.DecodeString("6368616e676520746869732070617373")
+	require.Nil(t, err)
+	aes := cipher.AESConfig{Key: key, Raw: true}
+
+	c := encrypt(t, aes.Encrypt, "hello world")
+	assert.Equal(t, "d40e94c52026c8f0239d95", hex.EncodeToString(c))
+
+	b, err := decrypt(aes.Decrypt, c)
+	require.Nil(t, err)
+	assert.Equal(t, "hello world", string(b))
+
+	// streams without a header are decrypted as if Raw were set
+	b, err = decrypt(cipher.AESConfig{Key: key}.Decrypt, encrypt(t, aes.Encrypt, inputLower))
+	require.Nil(t, err)
+	assert.Equal(t, inputLower, string(b))
+
+	b, err = decrypt(cipher.AESConfig{Key: key}.Decrypt, c[:2])
+	require.Nil(t, err)
+	assert.Equal(t, "he", string(b))
+
+	// but a stream with a header for another algorithm is still rejected
+	_, err = decrypt(cipher.AESConfig{Key: key}.Decrypt, encrypt(t, cipher.PassphraseConfig{Passphrase: key, LogN: 10}.Encrypt, inputLower))
+	assert.ErrorIs(t, err, cipher.ErrInvalidHeader)
+}
+
+func TestPassphrase(t *testing.T) {
+	pass := cipher.PassphraseConfig{Passphrase: []byte("change this pass"), LogN: 10}
+	gzip := compress.GZIPConfig{}
+
+	output := bytes.NewBuffer(nil)
+
+	w, err := chain.NewWriteBuilder(pass.Encrypt).
+		Then(gzip.Compress).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, "hello world")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	ciphertext := output.Bytes()
+
+	// The reader only needs the passphrase, the parameters come from the header
+	decrypt := cipher.PassphraseConfig{Passphrase: []byte("change this pass")}
+	r, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(ciphertext))).
+		Then(gzip.Decompress).
+		Finally(decrypt.Decrypt)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+	assert.Equal(t, "hello world", string(b))
+
+	wrong := cipher.PassphraseConfig{Passphrase: []byte("wrong pass")}
+	r, err = chain.ReadingFrom(io.NopCloser(bytes.NewReader(ciphertext))).
+		Then(gzip.Decompress).
+		Finally(wrong.Decrypt)
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, cipher.ErrAuthentication, err)
+	require.Nil(t, r.Close())
+}
+
+func TestPassphrase_ForgedHeader(t *testing.T) {
+	pass := cipher.PassphraseConfig{Passphrase: []byte("change this pass")}
+	header := func(logN, r, p byte) []byte {
+		b := append([]byte("chnc\x01\x02"), make([]byte, 16)...)
+		return append(b, logN, r, p)
+	}
+
+	for name, h := range map[string][]byte{
+		"work factor":    header(cipher.MaxScryptLogN+1, 8, 1),
+		"huge r":         header(cipher.MaxScryptLogN, 255, 1),
+		"zero r":         header(10, 0, 1),
+		"zero p":         header(10, 8, 0),
+		"huge p":         header(10, 8, 255),
+		"zero work":      header(0, 8, 1),
+		"r over the cap": header(cipher.MaxScryptLogN, 9, 1),
+	} {
+		_, err := decrypt(pass.Decrypt, h)
+		assert.ErrorIs(t, err, cipher.ErrInvalidHeader, name)
+	}
+
+	// parameters that couldn't be decrypted aren't written either
+	output := bytes.NewBuffer(nil)
+	_, err := chain.NewWriteBuilder(cipher.PassphraseConfig{Passphrase: []byte("pass"), LogN: 20, R: 255}.Encrypt).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	assert.ErrorIs(t, err, cipher.ErrInvalidHeader)
+	assert.Equal(t, 0, output.Len())
+}
+
+func TestAge(t *testing.T) {
+	alice, err := age.GenerateX25519Identity()
+	require.Nil(t, err)
+	bob, err := age.GenerateX25519Identity()
+	require.Nil(t, err)
+	zip := archive.ZipConfig{}
+
+	for _, armor := range []bool{false, true} {
+		enc := cipher.AgeConfig{
+			Recipients: []age.Recipient{alice.Recipient(), bob.Recipient()},
+			Armor:      armor,
+		}
+
+		output := bytes.NewBuffer(nil)
+		w, err := chain.NewWriteBuilder(enc.Encrypt).
+			Create("hello.txt").
+			InFS(zip.FSWriter).
+			WritingTo(chain.NopWriteCloser{Writer: output})
+		require.Nil(t, err)
+		_, err = io.WriteString(w, "hello world")
+		require.Nil(t, err)
+		require.Nil(t, w.Close())
+
+		dec := cipher.AgeConfig{Identities: []age.Identity{bob}, Armor: armor}
+		r, err := chain.ReadingFrom(io.NopCloser(output)).
+			AsFS(zip.FSReader).
+			Open("hello.txt").
+			Finally(dec.Decrypt)
+		require.Nil(t, err)
+		b, err := ioutil.ReadAll(r)
+		require.Nil(t, err)
+		require.Nil(t, r.Close())
+		assert.Equal(t, "hello world", string(b))
+	}
+}
+
+func TestAge_Scrypt(t *testing.T) {
+	recipient, err := age.NewScryptRecipient("change this pass")
+	require.Nil(t, err)
+	recipient.SetWorkFactor(10)
+	identity, err := age.NewScryptIdentity("change this pass")
+	require.Nil(t, err)
+
+	output := bytes.NewBuffer(nil)
+	w, err := chain.NewWriteBuilder(cipher.AgeConfig{Recipients: []age.Recipient{recipient}}.Encrypt).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, "hello world")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	assert.True(t, bytes.HasPrefix(output.Bytes(), []byte("age-encryption.org/v1\n")))
+	ciphertext := output.Bytes()
+
+	r, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(ciphertext))).
+		Finally(cipher.AgeConfig{Identities: []age.Identity{identity}}.Decrypt)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+	assert.Equal(t, "hello world", string(b))
+
+	other, err := age.GenerateX25519Identity()
+	require.Nil(t, err)
+	_, err = chain.ReadingFrom(io.NopCloser(bytes.NewReader(ciphertext))).
+		Finally(cipher.AgeConfig{Identities: []age.Identity{other}}.Decrypt)
+	var noMatch *age.NoIdentityMatchError
+	assert.ErrorAs(t, err, &noMatch)
+}
@@ -2,6 +2,7 @@ package chain
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -50,7 +51,7 @@ func TestReaderClose_ErrorChain(t *testing.T) {
 
 	_, err := ReadingFrom(nopReadCloser(strings.NewReader("hello world"), &readerClosed)).
 		Finally(readChainError(Err1))
-	assert.EqualError(t, err, "Error 1")
+	assert.EqualError(t, err, "chain: stage 0: Error 1")
 	assert.True(t, readerClosed)
 }
 
@@ -72,7 +73,7 @@ func TestWriterClose_ErrorChain(t *testing.T) {
 
 	_, err := NewWriteBuilder(writeChainError(Err1)).
 		WritingTo(nopWriteCloser(bytes.NewBuffer(nil), &writerClosed))
-	assert.EqualError(t, err, "Error 1")
+	assert.EqualError(t, err, "chain: stage 0: Error 1")
 	assert.True(t, writerClosed)
 }
 
@@ -154,3 +155,47 @@ func (n writeCloser) Close() error {
 	}
 	return err1
 }
+
+func TestWriteCloser2_Errors(t *testing.T) {
+	w := WriteCloser2{
+		WriteCloser: failingCloser{Err1},
+		Closer:      failingCloser{Err2},
+	}
+	err := w.Close()
+	assert.EqualError(t, err, "close chain.failingCloser: Error 1\nclose chain.failingCloser: Error 2")
+	assert.True(t, errors.Is(err, Err1))
+	assert.True(t, errors.Is(err, Err2))
+
+	var err2 ErrorString2
+	require.True(t, errors.As(err, &err2))
+	assert.Equal(t, Err2, err2)
+
+	var closeErr *CloseError
+	require.True(t, errors.As(err, &closeErr))
+	assert.Equal(t, "chain.failingCloser", closeErr.Closer)
+}
+
+func TestReadCloser2_Errors(t *testing.T) {
+	// nested errors are flattened rather than annotated again
+	r := ReadCloser2{
+		ReadCloser: failingCloser{Err1},
+		Closer: ReadCloser2{
+			ReadCloser: failingCloser{nil},
+			Closer:     failingCloser{Err2},
+		},
+	}
+	err := r.Close()
+	require.IsType(t, Errors{}, err)
+	assert.Len(t, err, 2)
+	assert.True(t, errors.Is(err, Err1))
+	assert.True(t, errors.Is(err, Err2))
+
+	assert.Nil(t, JoinErrors(nil, nil))
+	assert.Equal(t, Err1, JoinErrors(nil, Err1))
+}
+
+type failingCloser struct{ err error }
+
+func (failingCloser) Read([]byte) (int, error)    { return 0, io.EOF }
+func (failingCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (c failingCloser) Close() error              { return c.err }
@@ -0,0 +1,54 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/conradludgate/chain"
+)
+
+type format struct {
+	magic []byte
+	// next, if set, checks the bytes after the magic
+	next       func([]byte) bool
+	decompress chain.ReadChain
+}
+
+// formats that can be detected by Auto.
+// brotli and lzma streams have no magic bytes, so they can't be detected
+var formats = []format{
+	{[]byte{0x1f, 0x8b}, nil, (&GZIPConfig{}).Decompress},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, nil, (&ZstdConfig{}).Decompress},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, nil, (&XZConfig{}).Decompress},
+	{[]byte{'B', 'Z', 'h'}, bzip2BlockSize, (&BZIP2Config{}).Decompress},
+	{[]byte{0x04, 0x22, 0x4d, 0x18}, nil, (&LZ4Config{}).Decompress},
+	{[]byte{0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}, nil, (&SnappyConfig{}).Decompress},
+}
+
+// bzip2BlockSize checks for the block size that follows "BZh", from '1' to '9',
+// so that text starting with "BZh" isn't mistaken for bzip2
+func bzip2BlockSize(next []byte) bool {
+	return len(next) > 0 && next[0] >= '1' && next[0] <= '9'
+}
+
+const maxMagicSize = 10
+
+// Auto peeks at the first bytes of r to detect if it is compressed
+// with gzip, zstd, xz, bzip2, lz4 or snappy, and decompresses it with
+// the default config for that format. Otherwise, r is passed through unchanged.
+func Auto(r io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(maxMagicSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	buffered := chain.ReadCloser{Reader: br, Closer: r}
+	for _, f := range formats {
+		if bytes.HasPrefix(magic, f.magic) && (f.next == nil || f.next(magic[len(f.magic):])) {
+			return f.decompress(buffered)
+		}
+	}
+	return buffered, nil
+}
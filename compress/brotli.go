@@ -0,0 +1,37 @@
+package compress
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/conradludgate/chain"
+)
+
+type BrotliConfig struct {
+	// LGWin is the base 2 logarithm of the sliding window size.
+	// Range is 10 to 24. 0 indicates automatic configuration based on the level
+	LGWin int
+	level int
+}
+
+func (c *BrotliConfig) WithLevel(level int) *BrotliConfig {
+	// Like GZIPConfig, 0 is a valid level, so store it offset by 1
+	c.level = level + 1
+	return c
+}
+
+func (c *BrotliConfig) Compress(w io.WriteCloser) (io.WriteCloser, error) {
+	level := brotli.DefaultCompression
+	if c.level > 0 {
+		level = c.level - 1
+	}
+	bw := brotli.NewWriterOptions(w, brotli.WriterOptions{
+		Quality: level,
+		LGWin:   c.LGWin,
+	})
+	return chain.WriteCloser2{WriteCloser: bw, Closer: w}, nil
+}
+
+func (c *BrotliConfig) Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	return chain.ReadCloser{Reader: brotli.NewReader(r), Closer: r}, nil
+}
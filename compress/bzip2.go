@@ -0,0 +1,16 @@
+package compress
+
+import (
+	"compress/bzip2"
+	"io"
+
+	"github.com/conradludgate/chain"
+)
+
+// BZIP2Config decompresses bzip2 streams.
+// There is no Compress, as the standard library only implements decompression
+type BZIP2Config struct{}
+
+func (c *BZIP2Config) Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	return chain.ReadCloser{Reader: bzip2.NewReader(r), Closer: r}, nil
+}
@@ -3,11 +3,19 @@ package compress
 import (
 	"compress/gzip"
 	"io"
+	"runtime"
+
+	"github.com/conradludgate/chain"
+	"github.com/klauspost/pgzip"
 )
 
 type GZIPConfig struct {
 	Header gzip.Header
 	level  int
+
+	parallel  bool
+	blockSize int
+	workers   int
 }
 
 func (c *GZIPConfig) WithLevel(level int) *GZIPConfig {
@@ -17,15 +25,63 @@ func (c *GZIPConfig) WithLevel(level int) *GZIPConfig {
 	return c
 }
 
+// WithConcurrency makes Compress split the stream into blocks of blockSize bytes,
+// which are compressed by up to workers goroutines in parallel.
+// The output is still a single gzip stream, readable by any gzip reader.
+//
+// blockSize must be larger than 16KB. If it is not positive, it defaults to 1MB.
+// If workers is not positive, it defaults to GOMAXPROCS
+func (c *GZIPConfig) WithConcurrency(blockSize, workers int) *GZIPConfig {
+	c.parallel = true
+	c.blockSize = blockSize
+	c.workers = workers
+	return c
+}
+
 func (c *GZIPConfig) Compress(w io.WriteCloser) (io.WriteCloser, error) {
+	if c.parallel {
+		return c.compressParallel(w)
+	}
+
 	gw, err := gzip.NewWriterLevel(w, c.level-1)
 	if err != nil {
 		return nil, err
 	}
 	gw.Header = c.Header
-	return gw, nil
+	return chain.WriteCloser2{WriteCloser: gw, Closer: w}, nil
+}
+
+func (c *GZIPConfig) compressParallel(w io.WriteCloser) (io.WriteCloser, error) {
+	blockSize := c.blockSize
+	if blockSize <= 0 {
+		blockSize = 1 << 20
+	}
+	workers := c.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	gw, err := pgzip.NewWriterLevel(w, c.level-1)
+	if err != nil {
+		return nil, err
+	}
+	if err := gw.SetConcurrency(blockSize, workers); err != nil {
+		return nil, err
+	}
+	gw.Header = pgzip.Header{
+		Comment: c.Header.Comment,
+		Extra:   c.Header.Extra,
+		ModTime: c.Header.ModTime,
+		Name:    c.Header.Name,
+		OS:      c.Header.OS,
+	}
+	return chain.WriteCloser2{WriteCloser: gw, Closer: w}, nil
 }
 
 func (c *GZIPConfig) Decompress(r io.ReadCloser) (io.ReadCloser, error) {
-	return gzip.NewReader(r)
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return chain.ReadCloser2{ReadCloser: gr, Closer: r}, nil
 }
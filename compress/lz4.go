@@ -0,0 +1,31 @@
+package compress
+
+import (
+	"io"
+
+	"github.com/conradludgate/chain"
+	"github.com/pierrec/lz4/v4"
+)
+
+// LZ4Config compresses streams in the lz4 frame format.
+// Options are applied to both the writer and the reader,
+// eg lz4.CompressionLevelOption or lz4.ConcurrencyOption
+type LZ4Config struct {
+	Options []lz4.Option
+}
+
+func (c *LZ4Config) Compress(w io.WriteCloser) (io.WriteCloser, error) {
+	lw := lz4.NewWriter(w)
+	if err := lw.Apply(c.Options...); err != nil {
+		return nil, err
+	}
+	return chain.WriteCloser2{WriteCloser: lw, Closer: w}, nil
+}
+
+func (c *LZ4Config) Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	lr := lz4.NewReader(r)
+	if err := lr.Apply(c.Options...); err != nil {
+		return nil, err
+	}
+	return chain.ReadCloser{Reader: lr, Closer: r}, nil
+}
@@ -0,0 +1,19 @@
+package compress
+
+import (
+	"io"
+
+	"github.com/conradludgate/chain"
+	"github.com/golang/snappy"
+)
+
+// SnappyConfig compresses streams in the snappy framing format
+type SnappyConfig struct{}
+
+func (c *SnappyConfig) Compress(w io.WriteCloser) (io.WriteCloser, error) {
+	return chain.WriteCloser2{WriteCloser: snappy.NewBufferedWriter(w), Closer: w}, nil
+}
+
+func (c *SnappyConfig) Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	return chain.ReadCloser{Reader: snappy.NewReader(r), Closer: r}, nil
+}
@@ -0,0 +1,53 @@
+package compress
+
+import (
+	"io"
+
+	"github.com/conradludgate/chain"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// XZConfig compresses streams in the xz format
+type XZConfig struct {
+	Writer xz.WriterConfig
+	Reader xz.ReaderConfig
+}
+
+func (c *XZConfig) Compress(w io.WriteCloser) (io.WriteCloser, error) {
+	xw, err := c.Writer.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return chain.WriteCloser2{WriteCloser: xw, Closer: w}, nil
+}
+
+func (c *XZConfig) Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	xr, err := c.Reader.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return chain.ReadCloser{Reader: xr, Closer: r}, nil
+}
+
+// LZMAConfig compresses streams in the legacy lzma format
+type LZMAConfig struct {
+	Writer lzma.WriterConfig
+	Reader lzma.ReaderConfig
+}
+
+func (c *LZMAConfig) Compress(w io.WriteCloser) (io.WriteCloser, error) {
+	lw, err := c.Writer.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return chain.WriteCloser2{WriteCloser: lw, Closer: w}, nil
+}
+
+func (c *LZMAConfig) Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	lr, err := c.Reader.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return chain.ReadCloser{Reader: lr, Closer: r}, nil
+}
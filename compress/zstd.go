@@ -0,0 +1,54 @@
+package compress
+
+import (
+	"io"
+
+	"github.com/conradludgate/chain"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdConfig compresses streams with Zstandard.
+//
+// Dictionary, if set, must be a zstd dictionary and is used both to compress and decompress.
+// Concurrency limits how many goroutines are used to compress or decompress a single stream.
+// If not set, it defaults to GOMAXPROCS.
+type ZstdConfig struct {
+	Level       zstd.EncoderLevel
+	Dictionary  []byte
+	Concurrency int
+}
+
+func (c *ZstdConfig) Compress(w io.WriteCloser) (io.WriteCloser, error) {
+	var opts []zstd.EOption
+	if c.Level != 0 {
+		opts = append(opts, zstd.WithEncoderLevel(c.Level))
+	}
+	if c.Dictionary != nil {
+		opts = append(opts, zstd.WithEncoderDict(c.Dictionary))
+	}
+	if c.Concurrency > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(c.Concurrency))
+	}
+
+	zw, err := zstd.NewWriter(w, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return chain.WriteCloser2{WriteCloser: zw, Closer: w}, nil
+}
+
+func (c *ZstdConfig) Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	var opts []zstd.DOption
+	if c.Dictionary != nil {
+		opts = append(opts, zstd.WithDecoderDicts(c.Dictionary))
+	}
+	if c.Concurrency > 0 {
+		opts = append(opts, zstd.WithDecoderConcurrency(c.Concurrency))
+	}
+
+	zr, err := zstd.NewReader(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return chain.ReadCloser2{ReadCloser: zr.IOReadCloser(), Closer: r}, nil
+}
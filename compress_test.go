@@ -0,0 +1,131 @@
+package chain_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/compress"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type compressor interface {
+	Compress(io.WriteCloser) (io.WriteCloser, error)
+	Decompress(io.ReadCloser) (io.ReadCloser, error)
+}
+
+func TestCompress(t *testing.T) {
+	input := strings.Repeat(inputLower, 1000)
+
+	compressors := map[string]compressor{
+		"gzip":   &compress.GZIPConfig{},
+		"pgzip":  (&compress.GZIPConfig{}).WithLevel(9).WithConcurrency(20000, 4),
+		"zstd":   &compress.ZstdConfig{Level: zstd.SpeedBestCompression, Concurrency: 2},
+		"xz":     &compress.XZConfig{},
+		"lzma":   &compress.LZMAConfig{},
+		"lz4":    &compress.LZ4Config{Options: []lz4.Option{lz4.ConcurrencyOption(2)}},
+		"brotli": (&compress.BrotliConfig{}).WithLevel(0),
+		"snappy": &compress.SnappyConfig{},
+	}
+
+	for name, c := range compressors {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			output := bytes.NewBuffer(nil)
+
+			w, err := chain.NewWriteBuilder(c.Compress).
+				WritingTo(chain.NopWriteCloser{Writer: output})
+			require.Nil(t, err)
+			_, err = io.WriteString(w, input)
+			require.Nil(t, err)
+			require.Nil(t, w.Close())
+
+			assert.Less(t, output.Len(), len(input))
+
+			r, err := chain.ReadingFrom(io.NopCloser(output)).
+				Finally(c.Decompress)
+			require.Nil(t, err)
+			b, err := ioutil.ReadAll(r)
+			require.Nil(t, err)
+			require.Nil(t, r.Close())
+
+			assert.Equal(t, input, string(b))
+		})
+	}
+}
+
+func TestBZIP2(t *testing.T) {
+	// printf 'hello world\n' | bzip2
+	input, err := hex.DecodeString("425a68393141592653594eece83600000251800010400006449080200031064c4101a7a9a580bb9431f8bb9229c28482776741b0")
+	require.Nil(t, err)
+	bzip2 := compress.BZIP2Config{}
+
+	r, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(input))).
+		Finally(bzip2.Decompress)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+
+	assert.Equal(t, "hello world\n", string(b))
+}
+
+func TestAuto(t *testing.T) {
+	bzip2, err := hex.DecodeString("425a68393141592653594eece83600000251800010400006449080200031064c4101a7a9a580bb9431f8bb9229c28482776741b0")
+	require.Nil(t, err)
+
+	inputs := map[string][]byte{
+		"plain": []byte("hello world\n"),
+		"empty": nil,
+		"bzip2": bzip2,
+	}
+	compressors := map[string]compressor{
+		"gzip":   &compress.GZIPConfig{},
+		"zstd":   &compress.ZstdConfig{},
+		"xz":     &compress.XZConfig{},
+		"lz4":    &compress.LZ4Config{},
+		"snappy": &compress.SnappyConfig{},
+	}
+	for name, c := range compressors {
+		output := bytes.NewBuffer(nil)
+		w, err := chain.NewWriteBuilder(c.Compress).
+			WritingTo(chain.NopWriteCloser{Writer: output})
+		require.Nil(t, err)
+		_, err = io.WriteString(w, "hello world\n")
+		require.Nil(t, err)
+		require.Nil(t, w.Close())
+		inputs[name] = output.Bytes()
+	}
+
+	for name, input := range inputs {
+		r, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(input))).
+			Finally(compress.Auto)
+		require.Nil(t, err, name)
+		b, err := ioutil.ReadAll(r)
+		require.Nil(t, err, name)
+		require.Nil(t, r.Close(), name)
+
+		if name == "empty" {
+			assert.Empty(t, b)
+		} else {
+			assert.Equal(t, "hello world\n", string(b), name)
+		}
+	}
+
+	// text that starts like bzip2, but without a block size, is passed through
+	for _, input := range []string{"BZh is not bzip2", "BZh"} {
+		r, err := chain.ReadingFrom(io.NopCloser(bytes.NewBufferString(input))).
+			Finally(compress.Auto)
+		require.Nil(t, err, input)
+		b, err := ioutil.ReadAll(r)
+		require.Nil(t, err, input)
+		assert.Equal(t, input, string(b))
+	}
+}
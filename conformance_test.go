@@ -0,0 +1,161 @@
+package chain_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/archive"
+	"github.com/conradludgate/chain/chaintest"
+	"github.com/conradludgate/chain/cipher"
+	"github.com/conradludgate/chain/cipher/pgp"
+	"github.com/conradludgate/chain/compress"
+	"github.com/conradludgate/chain/encoding"
+	"github.com/conradludgate/chain/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hello world\n, compressed with bzip2 -9
+const helloBZIP2 = "QlpoOTFBWSZTWU7s6DYAAAJRgAAQQAAGRJCAIAAxBkxBAaeppYC7lDH4u5IpwoSCd2dBsA=="
+
+// hello world\n, hashed with sha256sum
+const helloSHA256 = "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447"
+
+func TestConformance(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.Nil(t, err)
+	key := []byte("0123456789abcdef0123456789abcdef")
+	digest, err := hex.DecodeString(helloSHA256)
+	require.Nil(t, err)
+	ageCfg := cipher.AgeConfig{Recipients: []age.Recipient{identity.Recipient()}, Identities: []age.Identity{identity}}
+	ageArmor := ageCfg
+	ageArmor.Armor = true
+
+	stages := map[string]struct {
+		write chain.WriteChain
+		read  chain.ReadChain
+	}{
+		"gzip":        {(&compress.GZIPConfig{}).Compress, (&compress.GZIPConfig{}).Decompress},
+		"pgzip":       {(&compress.GZIPConfig{}).WithConcurrency(1<<16, 2).Compress, (&compress.GZIPConfig{}).Decompress},
+		"zstd":        {(&compress.ZstdConfig{}).Compress, (&compress.ZstdConfig{}).Decompress},
+		"xz":          {(&compress.XZConfig{}).Compress, (&compress.XZConfig{}).Decompress},
+		"lzma":        {(&compress.LZMAConfig{}).Compress, (&compress.LZMAConfig{}).Decompress},
+		"lz4":         {(&compress.LZ4Config{}).Compress, (&compress.LZ4Config{}).Decompress},
+		"brotli":      {(&compress.BrotliConfig{}).Compress, (&compress.BrotliConfig{}).Decompress},
+		"snappy":      {(&compress.SnappyConfig{}).Compress, (&compress.SnappyConfig{}).Decompress},
+		"auto":        {(&compress.ZstdConfig{}).Compress, compress.Auto},
+		"aes":         {cipher.AESConfig{Key: key}.Encrypt, cipher.AESConfig{Key: key}.Decrypt},
+		"aes raw":     {cipher.AESConfig{Key: key, Raw: true}.Encrypt, cipher.AESConfig{Key: key, Raw: true}.Decrypt},
+		"gcm":         {cipher.GCMConfig{Key: key}.Encrypt, cipher.GCMConfig{Key: key}.Decrypt},
+		"passphrase":  {cipher.PassphraseConfig{Passphrase: key, LogN: 10}.Encrypt, cipher.PassphraseConfig{Passphrase: key}.Decrypt},
+		"age":         {ageCfg.Encrypt, ageCfg.Decrypt},
+		"age armor":   {ageArmor.Encrypt, ageArmor.Decrypt},
+		"pgp":         {pgp.Config{Passphrase: key}.Encrypt, pgp.Config{Passphrase: key}.Decrypt},
+		"base64":      {encoding.Base64Config{Encoding: base64.StdEncoding}.Encode, encoding.Base64Config{Encoding: base64.StdEncoding}.Decode},
+		"hex":         {encoding.Hex.Encode, encoding.Hex.Decode},
+		"hash":        {hash.Config{}.Record(&hash.Digest{}), hash.Config{Expected: digest}.Verify},
+		"writer func": {chain.WriterFunc(func(w io.Writer) io.Writer { return w }), chain.ReaderFunc(func(r io.Reader) io.Reader { return r })},
+	}
+
+	for name, stage := range stages {
+		stage := stage
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, chaintest.TestWriteChain(stage.write))
+
+			buf := &chain.Buffer{}
+			w, err := chain.NewWriteBuilder(stage.write).WritingTo(buf)
+			require.Nil(t, err)
+			_, err = io.WriteString(w, "hello world\n")
+			require.Nil(t, err)
+			require.Nil(t, w.Close())
+
+			assert.Nil(t, chaintest.TestReadChain(stage.read, buf.Bytes()))
+		})
+	}
+
+	// file systems don't close the writer they're given, so InFS has to
+	for name, fsWriter := range map[string]chain.WriteFSChain{
+		"zip": archive.ZipConfig{}.FSWriter,
+		"tar": archive.TarConfig{}.FSWriter,
+	} {
+		inFS := func(w io.WriteCloser) (io.WriteCloser, error) {
+			return chain.NewWriteBuilder(ToLower).
+				Create("hello.txt").
+				InFS(fsWriter).
+				WritingTo(w)
+		}
+		assert.Nil(t, chaintest.TestWriteChain(inFS), name)
+	}
+
+	t.Run("bzip2", func(t *testing.T) {
+		input, err := base64.StdEncoding.DecodeString(helloBZIP2)
+		require.Nil(t, err)
+		assert.Nil(t, chaintest.TestReadChain((&compress.BZIP2Config{}).Decompress, input))
+	})
+}
+
+func TestConformance_Builders(t *testing.T) {
+	// a built chain closes each stage, then what it's built on, and returns their errors,
+	// so it can be used as a stage itself
+	assert.Nil(t, chaintest.TestWriteChain(func(w io.WriteCloser) (io.WriteCloser, error) {
+		return chain.NewWriteBuilder(ToLower).Then(RemoveABC).WritingTo(w)
+	}))
+	assert.Nil(t, chaintest.TestReadChain(func(r io.ReadCloser) (io.ReadCloser, error) {
+		return chain.ReadingFrom(r).Then(ToUpper).Finally(RemoveXYZ)
+	}, []byte(inputLower)))
+}
+
+func TestConformance_Failing(t *testing.T) {
+	// a stage that doesn't close the writer it wraps
+	leaky := func(w io.WriteCloser) (io.WriteCloser, error) {
+		return chain.NopWriteCloser{Writer: w}, nil
+	}
+	err := chaintest.TestWriteChain(leaky)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "closed the wrapped writer 0 times")
+
+	// a stage that closes the reader it wraps when it fails to build
+	eager := func(r io.ReadCloser) (io.ReadCloser, error) {
+		if _, err := r.Read(make([]byte, 1)); err != nil {
+			r.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+	err = chaintest.TestReadChain(eager, bytes.Repeat([]byte("a"), 10))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "closed the wrapped reader, which is the builder's job")
+}
+
+func TestConformance_FS(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range chaintest.Dirs() {
+		require.Nil(t, os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0o777))
+	}
+	osFS := chain.OS{RootDir: dir}
+	assert.Nil(t, chaintest.TestFS(osFS, func() (chain.ReadFS, error) { return osFS, nil }))
+
+	gzip := compress.GZIPConfig{}
+	for name, cfg := range map[string]struct {
+		writer chain.WriteFSChain
+		reader chain.ReadFSChain
+	}{
+		"zip": {archive.ZipConfig{}.FSWriter, archive.ZipConfig{}.FSReader},
+		"tar": {archive.TarConfig{}.FSWriter, archive.TarConfig{}.FSReader},
+	} {
+		buf := &chain.Buffer{}
+		wfs, err := chain.NewWriteBuilder(encoding.Hex.Encode).IntoFS(cfg.writer).Then(gzip.Compress).WritingTo(buf)
+		require.Nil(t, err)
+		open := func() (chain.ReadFS, error) {
+			return chain.ReadingFrom(io.NopCloser(buf)).Then(gzip.Decompress).AsFS(cfg.reader).Finally(encoding.Hex.Decode)
+		}
+		assert.Nil(t, chaintest.TestFS(wfs, open), name)
+	}
+}
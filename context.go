@@ -0,0 +1,158 @@
+package chain
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// ReadingFromContext is like ReadingFrom, but once ctx is cancelled,
+// reading from the chain returns ctx.Err().
+//
+// So that a read blocked on r stops promptly, r is closed as soon as ctx is cancelled,
+// from another goroutine. r must be safe to close while it's being read from,
+// as files, pipes and network connections are.
+// Closing the chain still closes every stage, and r if it hasn't been already.
+//
+// The context is also used for each file opened through AsFS.
+func ReadingFromContext(ctx context.Context, r io.ReadCloser) *ReaderBuilder {
+	return &ReaderBuilder{r: contextReader{ReadCloser: newContextSource(ctx, r), ctx: ctx}, ctx: ctx}
+}
+
+// WritingToContext is like WritingTo, but once ctx is cancelled,
+// writing to the chain returns ctx.Err().
+//
+// So that a write blocked on w stops promptly, w is aborted as soon as ctx is cancelled,
+// from another goroutine, or closed if it isn't an Aborter. w must be safe to abort while it's
+// being written to, as files, pipes and network connections are.
+// Closing the chain after ctx is cancelled aborts it, as with Abort,
+// so that w is released without the stages finalising their output.
+func (wc *WriterBuilder) WritingToContext(ctx context.Context, w io.WriteCloser) (io.WriteCloser, error) {
+	if err := ctx.Err(); err != nil {
+		Abort(w, err)
+		return nil, err
+	}
+	cw, err := wc.WritingTo(newContextSink(ctx, w))
+	if err != nil {
+		return nil, err
+	}
+	return contextWriter{WriteCloser: cw, ctx: ctx}, nil
+}
+
+// watch calls interrupt from another goroutine once ctx is done,
+// unless the returned stop function is called first
+func watch(ctx context.Context, interrupt func()) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			interrupt()
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// contextSource is the reader at the start of a chain, which is closed once ctx is done
+type contextSource struct {
+	io.ReadCloser
+	stop func()
+	once sync.Once
+	err  error
+}
+
+func newContextSource(ctx context.Context, r io.ReadCloser) *contextSource {
+	s := &contextSource{ReadCloser: r}
+	s.stop = watch(ctx, func() { s.close() })
+	return s
+}
+
+func (s *contextSource) close() error {
+	s.once.Do(func() { s.err = s.ReadCloser.Close() })
+	return s.err
+}
+
+func (s *contextSource) Close() error {
+	s.stop()
+	return s.close()
+}
+
+// contextSink is the writer at the end of a chain, which is aborted once ctx is done
+type contextSink struct {
+	io.WriteCloser
+	stop func()
+	once sync.Once
+	err  error
+}
+
+func newContextSink(ctx context.Context, w io.WriteCloser) *contextSink {
+	s := &contextSink{WriteCloser: w}
+	s.stop = watch(ctx, func() { s.abort(ctx.Err()) })
+	return s
+}
+
+func (s *contextSink) abort(err error) error {
+	s.once.Do(func() { s.err = Abort(s.WriteCloser, err) })
+	return s.err
+}
+
+func (s *contextSink) Close() error {
+	s.stop()
+	s.once.Do(func() { s.err = s.WriteCloser.Close() })
+	return s.err
+}
+
+func (s *contextSink) Abort(err error) error {
+	s.stop()
+	return s.abort(err)
+}
+
+type contextReader struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && r.ctx.Err() != nil {
+		// the source was closed because ctx was cancelled
+		return n, r.ctx.Err()
+	}
+	return n, err
+}
+
+type contextWriter struct {
+	io.WriteCloser
+	ctx context.Context
+}
+
+func (w contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.WriteCloser.Write(p)
+	if err != nil && w.ctx.Err() != nil {
+		// the sink was aborted because ctx was cancelled
+		return n, w.ctx.Err()
+	}
+	return n, err
+}
+
+func (w contextWriter) Close() error {
+	if err := w.ctx.Err(); err != nil {
+		Abort(w.WriteCloser, err)
+		return err
+	}
+	return w.WriteCloser.Close()
+}
+
+func (w contextWriter) Abort(err error) error {
+	return Abort(w.WriteCloser, err)
+}
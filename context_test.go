@@ -0,0 +1,158 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type closeFlag struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeFlag) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReadingFromContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &closeFlag{Reader: strings.NewReader(strings.Repeat(inputLower, 100))}
+	r, err := chain.ReadingFromContext(ctx, src).
+		Then(ToUpper).
+		Finally(RemoveXYZ)
+	require.Nil(t, err)
+
+	b := make([]byte, 10)
+	_, err = io.ReadFull(r, b)
+	require.Nil(t, err)
+	assert.Equal(t, "ABCDEFGHIJ", string(b))
+
+	cancel()
+	_, err = r.Read(b)
+	assert.Equal(t, context.Canceled, err)
+
+	require.Nil(t, r.Close())
+	assert.True(t, src.closed)
+}
+
+func TestWritingToContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gzip := compress.GZIPConfig{}
+	buf := &chain.Buffer{}
+	w, err := chain.NewWriteBuilder(gzip.Compress).
+		WritingToContext(ctx, buf)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+
+	cancel()
+	_, err = io.WriteString(w, inputUpper)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, w.Close())
+	assert.Equal(t, 0, buf.Len())
+
+	_, err = chain.NewWriteBuilder(ToLower).
+		WritingToContext(ctx, chain.NopWriteCloser{Writer: bytes.NewBuffer(nil)})
+	assert.Equal(t, context.Canceled, err)
+
+	// a file that's already cancelled is aborted, rather than committed empty
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello world\n"), 0o644))
+	_, err = chain.NewWriteBuilder(ToLower).
+		WritingToContext(ctx, mustCreate(t, chain.OS{RootDir: dir, Atomic: true}, "hello.txt"))
+	assert.Equal(t, context.Canceled, err)
+	b, err := os.ReadFile(filepath.Join(dir, "hello.txt"))
+	require.Nil(t, err)
+	assert.Equal(t, "hello world\n", string(b))
+}
+
+// withinTimeout fails the test if f doesn't return promptly
+func withinTimeout(t *testing.T, f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelling the context didn't stop the blocked call")
+	}
+}
+
+func TestReadingFromContext_Blocked(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// nothing is ever written to the pipe, so reads block until it's closed
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	r, err := chain.ReadingFromContext(ctx, pr).Finally(ToUpper)
+	require.Nil(t, err)
+
+	withinTimeout(t, func() {
+		_, err = r.Read(make([]byte, 10))
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	require.Nil(t, r.Close())
+}
+
+// pipeFS opens the same reader whatever the path
+type pipeFS struct{ r io.ReadCloser }
+
+func (fs pipeFS) Open(string) (io.ReadCloser, error) { return fs.r, nil }
+func (pipeFS) Close() error                          { return nil }
+
+func TestReadingFromContext_AsFS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	rfs, err := chain.ReadingFromContext(ctx, io.NopCloser(strings.NewReader(""))).
+		AsFS(func(io.ReadCloser) (chain.ReadFS, error) { return pipeFS{pr}, nil }).
+		Finally(ToUpper)
+	require.Nil(t, err)
+	f, err := rfs.Open("blocked.txt")
+	require.Nil(t, err)
+
+	withinTimeout(t, func() {
+		_, err = f.Read(make([]byte, 10))
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	require.Nil(t, f.Close())
+	require.Nil(t, rfs.Close())
+}
+
+func TestWritingToContext_Blocked(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// nothing ever reads from the pipe, so writes block until it's closed
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	w, err := chain.NewWriteBuilder(ToLower).WritingToContext(ctx, pw)
+	require.Nil(t, err)
+
+	withinTimeout(t, func() {
+		_, err = io.WriteString(w, inputUpper)
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, context.DeadlineExceeded, w.Close())
+}
@@ -12,15 +12,13 @@ type Base64Config struct {
 }
 
 func (cfg Base64Config) Encode(w io.WriteCloser) (io.WriteCloser, error) {
-	return chain.WriteCloser2{
-		WriteCloser: base64.NewEncoder(cfg.Encoding, w),
-		Closer:      w,
-	}, nil
+	return chain.WriterFunc(func(w io.Writer) io.WriteCloser {
+		return base64.NewEncoder(cfg.Encoding, w)
+	})(w)
 }
 
 func (cfg Base64Config) Decode(r io.ReadCloser) (io.ReadCloser, error) {
-	return chain.ReadCloser{
-		Reader: base64.NewDecoder(cfg.Encoding, r),
-		Closer: r,
-	}, nil
+	return chain.ReaderFunc(func(r io.Reader) io.Reader {
+		return base64.NewDecoder(cfg.Encoding, r)
+	})(r)
 }
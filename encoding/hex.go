@@ -3,16 +3,18 @@ package encoding
 import (
 	"encoding/hex"
 	"io"
+
+	"github.com/conradludgate/chain"
 )
 
 type h struct{}
 
 var Hex h
 
-func (h) Encode(w io.Writer) (io.Writer, error) {
-	return hex.NewEncoder(w), nil
+func (h) Encode(w io.WriteCloser) (io.WriteCloser, error) {
+	return chain.WriterFunc(hex.NewEncoder)(w)
 }
 
-func (h) Decode(r io.Reader) (io.Reader, error) {
-	return hex.NewDecoder(r), nil
+func (h) Decode(r io.ReadCloser) (io.ReadCloser, error) {
+	return chain.ReaderFunc(hex.NewDecoder)(r)
 }
@@ -0,0 +1,156 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CloseError is an error from closing one part of a chain,
+// annotated with the type of what was being closed, such as *gzip.Writer or *os.File
+type CloseError struct {
+	Closer string
+	Err    error
+}
+
+func (e *CloseError) Error() string { return "close " + e.Closer + ": " + e.Err.Error() }
+
+func (e *CloseError) Unwrap() error { return e.Err }
+
+// Errors is a list of errors, such as from closing several parts of a chain.
+//
+// Like the errors returned by errors.Join, errors.Is and errors.As
+// match any of the errors in the list
+type Errors []error
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e Errors) Unwrap() []error { return e }
+
+// Is lets errors.Is match any of the errors,
+// for Go versions that don't support Unwrap() []error
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As lets errors.As match any of the errors,
+// for Go versions that don't support Unwrap() []error
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinErrors returns nil if every error in errs is nil,
+// the error itself if there's only one, and Errors otherwise.
+// Errors in errs that are themselves Errors are flattened into the list
+func JoinErrors(errs ...error) error {
+	var joined Errors
+	for _, err := range errs {
+		if more, ok := err.(Errors); ok {
+			joined = append(joined, more...)
+		} else if err != nil {
+			joined = append(joined, err)
+		}
+	}
+	switch len(joined) {
+	case 0:
+		return nil
+	case 1:
+		return joined[0]
+	}
+	return joined
+}
+
+// closeError annotates err with what c is, unless it is already annotated
+func closeError(c io.Closer, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce *CloseError
+	var errs Errors
+	if errors.As(err, &ce) || errors.As(err, &errs) {
+		return err
+	}
+	return &CloseError{Closer: fmt.Sprintf("%T", c), Err: err}
+}
+
+// closeAll closes every closer, even if some of them fail,
+// and returns all the errors they fail with
+func closeAll(closers ...io.Closer) error {
+	errs := make([]error, len(closers))
+	for i, c := range closers {
+		errs[i] = closeError(c, c.Close())
+	}
+	return JoinErrors(errs...)
+}
+
+// StageError is returned when a chain can't be built, or a file can't be opened
+// or created in a file system built from a chain.
+// It records where in the chain the error came from.
+type StageError struct {
+	// Stage is the index of the stage in its builder, in the order
+	// they were added, or -1 if the error isn't from a stage
+	Stage int
+	// Name is the name of the stage, if it has one
+	Name string
+	// Path is the file being opened or created, if any
+	Path string
+	Err  error
+}
+
+func (e *StageError) Error() string {
+	s := "chain: "
+	if e.Stage >= 0 {
+		s += "stage " + strconv.Itoa(e.Stage)
+		if e.Name != "" {
+			s += " (" + e.Name + ")"
+		}
+		if e.Path != "" {
+			s += " of "
+		}
+	}
+	return s + e.Path + ": " + e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// stageError wraps err in a StageError. If err is already a StageError,
+// the stage and path are added to it if it doesn't have them
+func stageError(stage int, name, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	se, ok := err.(*StageError)
+	if !ok {
+		return &StageError{Stage: stage, Name: name, Path: path, Err: err}
+	}
+	if (se.Stage >= 0 || stage < 0) && (se.Path != "" || path == "") {
+		return se
+	}
+	filled := *se
+	if filled.Stage < 0 {
+		filled.Stage = stage
+		filled.Name = name
+	}
+	if filled.Path == "" {
+		filled.Path = path
+	}
+	return &filled
+}
@@ -2,14 +2,19 @@ package chain_test
 
 import (
 	"bytes"
+	gz "compress/gzip"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"io"
+	"io/fs"
+	"strings"
 	"testing"
 
 	"github.com/conradludgate/chain"
 	"github.com/conradludgate/chain/archive"
 	"github.com/conradludgate/chain/cipher"
+	"github.com/conradludgate/chain/compress"
 	"github.com/conradludgate/chain/encoding"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -119,3 +124,35 @@ func TestIntoFS(t *testing.T) {
 	err = wfs.Close()
 	require.Nil(t, err)
 }
+
+func TestStageError(t *testing.T) {
+	gzip := compress.GZIPConfig{}
+
+	_, err := chain.ReadingFrom(io.NopCloser(strings.NewReader(inputLower))).
+		Then(ToUpper).
+		Finally(gzip.Decompress)
+	var stageErr *chain.StageError
+	require.True(t, errors.As(err, &stageErr))
+	assert.Equal(t, 1, stageErr.Stage)
+	assert.Equal(t, "", stageErr.Path)
+	assert.ErrorIs(t, err, gz.ErrHeader)
+	assert.EqualError(t, err, "chain: stage 1: gzip: invalid header")
+
+	rfs, err := chain.ReadingFromFS(chain.OS{RootDir: "./example"}).
+		Finally(gzip.Decompress)
+	require.Nil(t, err)
+	defer rfs.Close()
+
+	_, err = rfs.Open("hello.txt")
+	require.True(t, errors.As(err, &stageErr))
+	assert.Equal(t, 0, stageErr.Stage)
+	assert.Equal(t, "hello.txt", stageErr.Path)
+	assert.ErrorIs(t, err, gz.ErrHeader)
+	assert.EqualError(t, err, "chain: stage 0 of hello.txt: gzip: invalid header")
+
+	_, err = rfs.Open("missing.txt")
+	require.True(t, errors.As(err, &stageErr))
+	assert.Equal(t, -1, stageErr.Stage)
+	assert.Equal(t, "missing.txt", stageErr.Path)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
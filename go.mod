@@ -1,5 +1,24 @@
 module github.com/conradludgate/chain
 
-go 1.16
+go 1.18
 
-require github.com/stretchr/testify v1.7.0
+require (
+	filippo.io/age v1.0.0
+	github.com/ProtonMail/go-crypto v1.0.0
+	github.com/andybalholm/brotli v1.0.4
+	github.com/golang/snappy v0.0.4
+	github.com/klauspost/compress v1.13.6
+	github.com/klauspost/pgzip v1.2.5
+	github.com/pierrec/lz4/v4 v4.1.11
+	github.com/stretchr/testify v1.7.0
+	github.com/ulikunitz/xz v0.5.10
+	golang.org/x/crypto v0.7.0
+)
+
+require (
+	github.com/cloudflare/circl v1.3.3 // indirect
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.6.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
@@ -0,0 +1,190 @@
+// Package hash provides stages that checksum the data flowing through a chain.
+//
+// Record computes the digest of what is written, into a Digest for each chain,
+// and Verify checks what is read against an expected digest. Like any other stage,
+// they can go anywhere in a chain, so either the plaintext or the ciphertext can be checksummed.
+package hash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	stdhash "hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/conradludgate/chain"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Algorithm is a hash function, named as in the extension of its sidecar files
+type Algorithm string
+
+const (
+	SHA256  Algorithm = "sha256"
+	BLAKE2b Algorithm = "blake2b"
+	CRC32C  Algorithm = "crc32c"
+)
+
+var (
+	// ErrMismatch is returned at the end of a stream that doesn't match its expected digest
+	ErrMismatch = errors.New("hash: checksum mismatch")
+
+	// ErrNoDigest is returned by Verify if there is no expected digest to verify against
+	ErrNoDigest = errors.New("hash: no expected digest")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// New returns a new hash for the algorithm. BLAKE2b sums are 256 bits
+func (a Algorithm) New() (stdhash.Hash, error) {
+	switch a {
+	case SHA256, "":
+		return sha256.New(), nil
+	case BLAKE2b:
+		return blake2b.New256(nil)
+	case CRC32C:
+		return crc32.New(castagnoli), nil
+	}
+	return nil, fmt.Errorf("hash: unknown algorithm %q", string(a))
+}
+
+// Config checksums a stream with Algorithm, which defaults to SHA256
+type Config struct {
+	Algorithm Algorithm
+
+	// Expected is the digest that Verify checks the stream against
+	Expected []byte
+
+	// Sidecar, if set, is where Record writes the digest once the stream is committed,
+	// to Name with the algorithm as its extension, such as backup.tar.sha256.
+	// It's written in the format of sha256sum, so it can be checked with sha256sum -c
+	Sidecar chain.WriteFS
+	Name    string
+}
+
+// Digest is the digest of a stream written through Record
+type Digest struct {
+	Algorithm Algorithm
+	// Sum is set once the chain has been closed, and what it writes to has committed the stream.
+	// It is nil until then, and stays nil if the stream is aborted or fails to close
+	Sum []byte
+}
+
+func (cfg Config) algorithm() Algorithm {
+	if cfg.Algorithm == "" {
+		return SHA256
+	}
+	return cfg.Algorithm
+}
+
+// Record returns a stage that computes the digest of everything written through it,
+// and stores it in d once the chain is closed. Each chain should have its own Digest.
+//
+// The digest is only recorded, and the sidecar written, once the whole chain has closed,
+// including a destination that only commits then, such as a file created by chain.OS in Atomic mode.
+// So the stage records nothing unless it's built into a chain, which commits it as a chain.Committer
+func (cfg Config) Record(d *Digest) chain.WriteChain {
+	return func(w io.WriteCloser) (io.WriteCloser, error) {
+		h, err := cfg.algorithm().New()
+		if err != nil {
+			return nil, err
+		}
+		*d = Digest{Algorithm: cfg.algorithm()}
+		return &writer{w: w, h: h, cfg: cfg, digest: d}, nil
+	}
+}
+
+type writer struct {
+	w      io.WriteCloser
+	h      stdhash.Hash
+	cfg    Config
+	digest *Digest
+	done   bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.h.Write(p[:n])
+	return n, err
+}
+
+func (w *writer) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	return w.w.Close()
+}
+
+// Commit records the digest once the chain has committed what was written,
+// so that a sidecar file is never written for data that failed to write
+func (w *writer) Commit() error {
+	w.digest.Sum = w.h.Sum(nil)
+	if w.cfg.Sidecar == nil {
+		return nil
+	}
+	return w.cfg.writeSidecar(w.digest.Sum)
+}
+
+func (w *writer) Abort(err error) error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	return chain.Abort(w.w, err)
+}
+
+func (cfg Config) writeSidecar(sum []byte) error {
+	f, err := cfg.Sidecar.Create(cfg.Name + "." + string(cfg.algorithm()))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%s  %s\n", hex.EncodeToString(sum), cfg.Name)
+	return chain.JoinErrors(err, f.Close())
+}
+
+// Verify checks everything read through it against Expected.
+// Reading returns ErrMismatch at the end of the stream, instead of io.EOF, if it doesn't match
+func (cfg Config) Verify(r io.ReadCloser) (io.ReadCloser, error) {
+	if len(cfg.Expected) == 0 {
+		return nil, ErrNoDigest
+	}
+	h, err := cfg.algorithm().New()
+	if err != nil {
+		return nil, err
+	}
+	return &reader{r: r, h: h, cfg: cfg}, nil
+}
+
+type reader struct {
+	r   io.ReadCloser
+	h   stdhash.Hash
+	cfg Config
+	// err is the result of verifying, once the stream has ended
+	err error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	sum := r.h.Sum(nil)
+	r.err = io.EOF
+	if !bytes.Equal(sum, r.cfg.Expected) {
+		r.err = fmt.Errorf("%w: %s is %x, expected %x", ErrMismatch, r.cfg.algorithm(), sum, r.cfg.Expected)
+	}
+	return n, r.err
+}
+
+func (r *reader) Close() error {
+	return r.r.Close()
+}
@@ -0,0 +1,161 @@
+package chain_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/compress"
+	"github.com/conradludgate/chain/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	for _, algorithm := range []hash.Algorithm{hash.SHA256, hash.BLAKE2b, hash.CRC32C} {
+		cfg := hash.Config{Algorithm: algorithm}
+		var digest hash.Digest
+		buf := &chain.Buffer{}
+		w, err := chain.NewWriteBuilder(cfg.Record(&digest)).WritingTo(buf)
+		require.Nil(t, err)
+		_, err = io.WriteString(w, inputUpper)
+		require.Nil(t, err)
+		assert.Nil(t, digest.Sum, algorithm)
+		require.Nil(t, w.Close())
+		require.NotNil(t, digest.Sum, algorithm)
+		assert.Equal(t, algorithm, digest.Algorithm)
+
+		verify := hash.Config{Algorithm: algorithm, Expected: digest.Sum}
+		r, err := chain.ReadingFrom(io.NopCloser(buf)).Finally(verify.Verify)
+		require.Nil(t, err)
+		b, err := io.ReadAll(r)
+		require.Nil(t, err, algorithm)
+		assert.Equal(t, inputUpper, string(b))
+	}
+
+	sum := sha256.Sum256([]byte(inputUpper))
+	cfg := hash.Config{Expected: sum[:]}
+	r, err := chain.ReadingFrom(io.NopCloser(bytes.NewBufferString(inputLower))).Finally(cfg.Verify)
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, hash.ErrMismatch)
+
+	_, err = chain.ReadingFrom(io.NopCloser(bytes.NewBufferString(inputLower))).Finally(hash.Config{}.Verify)
+	assert.ErrorIs(t, err, hash.ErrNoDigest)
+
+	var digest hash.Digest
+	_, err = chain.NewWriteBuilder(hash.Config{Algorithm: "md4"}.Record(&digest)).WritingTo(&chain.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestHash_SharedConfig(t *testing.T) {
+	// chains built from the same config each get their own digest
+	cfg := hash.Config{}
+	inputs := []string{inputLower, inputUpper}
+	digests := make([]hash.Digest, len(inputs))
+
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			w, err := chain.NewWriteBuilder(cfg.Record(&digests[i])).WritingTo(&chain.Buffer{})
+			if assert.Nil(t, err) {
+				io.WriteString(w, input)
+				assert.Nil(t, w.Close())
+			}
+		}(i, input)
+	}
+	wg.Wait()
+
+	for i, input := range inputs {
+		sum := sha256.Sum256([]byte(input))
+		assert.Equal(t, sum[:], digests[i].Sum)
+	}
+}
+
+func TestHash_Compressed(t *testing.T) {
+	gzip := compress.GZIPConfig{}
+
+	// checksum the compressed stream, as it's stored
+	var digest hash.Digest
+	buf := &chain.Buffer{}
+	w, err := chain.NewWriteBuilder(gzip.Compress).
+		Then(hash.Config{}.Record(&digest)).
+		WritingTo(buf)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	sum := sha256.Sum256(buf.Bytes())
+	assert.Equal(t, sum[:], digest.Sum)
+
+	verify := hash.Config{Expected: digest.Sum}
+	r, err := chain.ReadingFrom(io.NopCloser(bytes.NewReader(buf.Bytes()))).
+		Then(verify.Verify).
+		Finally(gzip.Decompress)
+	require.Nil(t, err)
+	b, err := io.ReadAll(r)
+	require.Nil(t, err)
+	assert.Equal(t, inputUpper, string(b))
+
+	// a flipped bit is caught without decompressing
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[len(corrupted)/2] ^= 1
+	r, err = chain.ReadingFrom(io.NopCloser(bytes.NewReader(corrupted))).Finally(verify.Verify)
+	require.Nil(t, err)
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, hash.ErrMismatch)
+}
+
+func TestHash_Sidecar(t *testing.T) {
+	dir := t.TempDir()
+	fs := chain.OS{RootDir: dir}
+
+	var digest hash.Digest
+	cfg := hash.Config{Sidecar: fs, Name: "hello.txt"}
+	w, err := chain.NewWriteBuilder(cfg.Record(&digest)).WritingTo(mustCreate(t, fs, "hello.txt"))
+	require.Nil(t, err)
+	_, err = io.WriteString(w, "hello world\n")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	b, err := os.ReadFile(filepath.Join(dir, "hello.txt.sha256"))
+	require.Nil(t, err)
+	assert.Equal(t, helloSHA256+"  hello.txt\n", string(b))
+	assert.Equal(t, helloSHA256, hex.EncodeToString(digest.Sum))
+
+	// nothing is recorded for an aborted stream
+	digest = hash.Digest{}
+	cfg = hash.Config{Sidecar: fs, Name: "aborted.txt"}
+	w, err = chain.NewWriteBuilder(cfg.Record(&digest)).WritingTo(&chain.Buffer{})
+	require.Nil(t, err)
+	require.Nil(t, chain.Abort(w, io.ErrUnexpectedEOF))
+	assert.Nil(t, digest.Sum)
+	_, err = os.Stat(filepath.Join(dir, "aborted.txt.sha256"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// or for one that fails to commit, after the stage has closed
+	cfg = hash.Config{Sidecar: fs, Name: "broken.txt"}
+	w, err = chain.NewWriteBuilder(cfg.Record(&digest)).WritingTo(&brokenCloser{})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, "hello world\n")
+	require.Nil(t, err)
+	assert.ErrorIs(t, w.Close(), errBroken)
+	assert.Nil(t, digest.Sum)
+	_, err = os.Stat(filepath.Join(dir, "broken.txt.sha256"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func mustCreate(t *testing.T, fs chain.WriteFS, name string) io.WriteCloser {
+	f, err := fs.Create(name)
+	require.Nil(t, err)
+	return f
+}
@@ -0,0 +1,311 @@
+package chain
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// ErrNotSupported is returned when a ReadFS
+// doesn't support the requested operation
+var ErrNotSupported = errors.New("chain: operation not supported by file system")
+
+// StatFS is a ReadFS that can describe the files in it.
+// It mirrors fs.StatFS
+type StatFS interface {
+	ReadFS
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// ReadDirFS is a ReadFS that can list the files in it.
+// It mirrors fs.ReadDirFS
+type ReadDirFS interface {
+	ReadFS
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// GlobFS is a ReadFS that can find the files matching a pattern.
+// It mirrors fs.GlobFS
+type GlobFS interface {
+	ReadFS
+	Glob(pattern string) ([]string, error)
+}
+
+// FromFS wraps an fs.FS so it can be used as a ReadFS,
+// such as the start of ReadingFromFS
+func FromFS(fsys fs.FS) ReadFS {
+	return fromFS{fsys: fsys}
+}
+
+type fromFS struct {
+	fsys fs.FS
+}
+
+func (f fromFS) Open(name string) (io.ReadCloser, error) {
+	return f.fsys.Open(name)
+}
+
+func (f fromFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, name)
+}
+
+func (f fromFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, name)
+}
+
+func (f fromFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(f.fsys, pattern)
+}
+
+func (f fromFS) Close() error {
+	if c, ok := f.fsys.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ToFS exposes a ReadFS as an fs.FS, so it can be used with
+// functions like fs.WalkDir, http.FS or template.ParseFS.
+//
+// Files and directories can only be described and listed
+// if rfs is a StatFS and ReadDirFS respectively, and they don't return ErrNotSupported.
+// Otherwise, files report a minimal fs.FileInfo with only their name,
+// and the only directory that can be opened is the root.
+//
+// Users of fs.FS, such as http.FS, expect the size of a file to be known.
+// If rfs reports it as negative, as when files are read through a chain,
+// the file is read through once to measure it whenever it's described.
+func ToFS(rfs ReadFS) fs.FS {
+	return ioFS{rfs: rfs}
+}
+
+type ioFS struct {
+	rfs ReadFS
+}
+
+func (f ioFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err := f.stat(name)
+	switch {
+	case errors.Is(err, ErrNotSupported):
+		if name == "." {
+			return &ioDir{fs: f, name: name, info: dirInfo(name)}, nil
+		}
+	case err != nil:
+		return nil, err
+	case info.IsDir():
+		return &ioDir{fs: f, name: name, info: info}, nil
+	}
+
+	rc, err := f.rfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if file, ok := rc.(fs.File); ok {
+		return file, nil
+	}
+	return &ioFile{ReadCloser: rc, fs: f, name: name}, nil
+}
+
+// stat returns ErrNotSupported if the ReadFS can't describe its files
+func (f ioFS) stat(name string) (fs.FileInfo, error) {
+	if sfs, ok := f.rfs.(StatFS); ok {
+		return sfs.Stat(name)
+	}
+	return nil, ErrNotSupported
+}
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := f.stat(name)
+	if !errors.Is(err, ErrNotSupported) {
+		if err != nil {
+			return nil, err
+		}
+		return f.sized(name, info)
+	}
+
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	rdfs, ok := f.rfs.(ReadDirFS)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: ErrNotSupported}
+	}
+
+	entries, err := rdfs.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for i, entry := range entries {
+		if !entry.IsDir() {
+			entries[i] = ioEntry{DirEntry: entry, fs: f, name: path.Join(name, entry.Name())}
+		}
+	}
+	return entries, nil
+}
+
+// sized measures the size of the file by reading it, if info doesn't know it
+func (f ioFS) sized(name string, info fs.FileInfo) (fs.FileInfo, error) {
+	if info.IsDir() || info.Size() >= 0 {
+		return info, nil
+	}
+	rc, err := f.rfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(io.Discard, rc)
+	if err = JoinErrors(err, rc.Close()); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return sizedInfo{FileInfo: info, size: size}, nil
+}
+
+func (f ioFS) Glob(pattern string) ([]string, error) {
+	if gfs, ok := f.rfs.(GlobFS); ok {
+		matches, err := gfs.Glob(pattern)
+		if !errors.Is(err, ErrNotSupported) {
+			return matches, err
+		}
+	}
+	// hide this method so fs.Glob falls back to using ReadDir
+	return fs.Glob(struct{ fs.FS }{f}, pattern)
+}
+
+type ioFile struct {
+	io.ReadCloser
+	fs   ioFS
+	name string
+}
+
+func (f *ioFile) Stat() (fs.FileInfo, error) {
+	if s, ok := f.ReadCloser.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		return s.Stat()
+	}
+	info, err := f.fs.stat(f.name)
+	if errors.Is(err, ErrNotSupported) {
+		return fileInfo{name: path.Base(f.name), mode: 0o444}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.sized(f.name, info)
+}
+
+type ioDir struct {
+	fs      ioFS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *ioDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *ioDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *ioDir) Close() error { return nil }
+
+func (d *ioDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func dirInfo(name string) fs.FileInfo {
+	return fileInfo{name: path.Base(name), mode: fs.ModeDir | 0o555}
+}
+
+// fileInfo is a minimal fs.FileInfo, for when
+// the file system can't describe its files
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+// unsizedInfo describes a file whose size isn't known, as it's read through a chain
+type unsizedInfo struct{ fs.FileInfo }
+
+func (unsizedInfo) Size() int64 { return -1 }
+
+// sizedInfo is an unsizedInfo once the file has been measured
+type sizedInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi sizedInfo) Size() int64 { return fi.size }
+
+type unsizedEntry struct{ fs.DirEntry }
+
+func (e unsizedEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return unsizedInfo{info}, nil
+}
+
+// ioEntry is an entry listed by ToFS, which measures the file if its size isn't known
+type ioEntry struct {
+	fs.DirEntry
+	fs   ioFS
+	name string
+}
+
+func (e ioEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return e.fs.sized(e.name, info)
+}
@@ -0,0 +1,153 @@
+package chain_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/archive"
+	"github.com/conradludgate/chain/compress"
+	"github.com/conradludgate/chain/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"hello.txt":         {Data: []byte("hello world\n")},
+		"nested/a.txt":      {Data: []byte(inputLower)},
+		"nested/dir/b.txt":  {Data: []byte(inputUpper)},
+		"nested/empty.txt":  {},
+		"other/goodbye.txt": {Data: []byte("goodbye world\n")},
+	}
+
+	require.Nil(t, fstest.TestFS(chain.ToFS(chain.FromFS(mapFS)),
+		"hello.txt", "nested/a.txt", "nested/dir/b.txt", "nested/empty.txt", "other/goodbye.txt"))
+}
+
+func TestToFS(t *testing.T) {
+	b64 := encoding.Base64Config{Encoding: base64.RawStdEncoding}
+
+	rfs, err := chain.ReadingFromFS(chain.OS{RootDir: "./example"}).Finally(b64.Decode)
+	require.Nil(t, err)
+	defer rfs.Close()
+
+	fsys := chain.ToFS(rfs)
+	b, err := fs.ReadFile(fsys, "hello.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "hello world\n", string(b))
+
+	_, err = fs.ReadFile(fsys, "../hello.txt")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+
+	_, err = fs.ReadFile(fsys, "missing.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestToFS_Size(t *testing.T) {
+	gzip := compress.GZIPConfig{}
+	buf := &chain.Buffer{}
+	w, err := chain.NewWriteBuilder(gzip.Compress).WritingTo(buf)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputLower)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	mapFS := fstest.MapFS{"dir/lower.txt.gz": {Data: buf.Bytes()}}
+	rfs, err := chain.ReadingFromFS(chain.FromFS(mapFS)).Finally(gzip.Decompress)
+	require.Nil(t, err)
+	defer rfs.Close()
+
+	// the size of the compressed file isn't the size of what's read
+	info, err := rfs.(chain.StatFS).Stat("dir/lower.txt.gz")
+	require.Nil(t, err)
+	assert.Equal(t, int64(-1), info.Size())
+
+	// so ToFS measures it
+	fsys := chain.ToFS(rfs)
+	info, err = fs.Stat(fsys, "dir/lower.txt.gz")
+	require.Nil(t, err)
+	assert.Equal(t, int64(len(inputLower)), info.Size())
+
+	entries, err := fs.ReadDir(fsys, "dir")
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	info, err = entries[0].Info()
+	require.Nil(t, err)
+	assert.Equal(t, int64(len(inputLower)), info.Size())
+
+	b, err := fs.ReadFile(fsys, "dir/lower.txt.gz")
+	require.Nil(t, err)
+	assert.Equal(t, inputLower, string(b))
+
+	require.Nil(t, fstest.TestFS(fsys, "dir/lower.txt.gz"))
+
+	srv := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/dir/lower.txt.gz")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assert.Equal(t, inputLower, string(b))
+}
+
+func TestReadDir(t *testing.T) {
+	zip := archive.ZipConfig{}
+	b64 := encoding.Base64Config{Encoding: base64.RawStdEncoding}
+
+	rfs, err := chain.ReadingFromFS(chain.OS{RootDir: "./example"}).
+		Open("archive.zip").
+		AsFS(zip.FSReader).
+		Finally(b64.Decode)
+	require.Nil(t, err)
+	defer rfs.Close()
+
+	files := map[string]string{}
+	err = fs.WalkDir(chain.ToFS(rfs), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		s, err := readFile(rfs, path)
+		files[path] = s
+		return err
+	})
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"hello.txt": "hello world\n"}, files)
+
+	matches, err := rfs.(chain.GlobFS).Glob("*.txt")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"hello.txt"}, matches)
+}
+
+func TestFS_Backends(t *testing.T) {
+	names := []string{"a.txt", "dir/b.txt", "dir/nested/c.txt", "d.txt"}
+
+	zip, err := archive.ZipConfig{}.FSReader(io.NopCloser(bytes.NewReader(writeZip(t, names...))))
+	require.Nil(t, err)
+	assert.Nil(t, fstest.TestFS(chain.ToFS(zip), names...))
+
+	output := bytes.NewBuffer(nil)
+	wfs, err := archive.TarConfig{}.FSWriter(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	for _, name := range names {
+		w, err := wfs.Create(name)
+		require.Nil(t, err)
+		_, err = io.WriteString(w, name)
+		require.Nil(t, err)
+		require.Nil(t, w.Close())
+	}
+	require.Nil(t, wfs.Close())
+	tar, err := archive.TarConfig{}.FSReader(io.NopCloser(output))
+	require.Nil(t, err)
+	assert.Nil(t, fstest.TestFS(chain.ToFS(tar), names...))
+
+	assert.Nil(t, fstest.TestFS(chain.ToFS(chain.OS{RootDir: "./example"}), "hello.txt", "archive.zip"))
+}
@@ -0,0 +1,99 @@
+package chain
+
+import (
+	"io"
+)
+
+// The operations an Event can describe
+const (
+	OpOpen   = "open"
+	OpCreate = "create"
+	OpStage  = "stage"
+	OpClose  = "close"
+)
+
+// Event describes something that happened while building or using a chain.
+// Close events are sent once the Close call has returned, so the stages
+// closer to the underlying writer or reader are reported first
+type Event struct {
+	// Op is one of OpOpen, OpCreate, OpStage or OpClose
+	Op string
+	// Path is the file that was opened or created, if any
+	Path string
+	// Stage is the index of the stage in its builder, in the order
+	// they were added, or -1 if the event isn't about a stage
+	Stage int
+	// Err is the error the operation failed with, if any
+	Err error
+}
+
+// Observer is called for every Event of the builders and file systems it is given to.
+// It can be used to log or trace what a chain is doing, such as with
+//
+//	func(e chain.Event) { log.Println(e.Op, e.Path, e.Stage, e.Err) }
+//
+// Observing a chain wraps the readers and writers of each stage to see them being closed,
+// so they can't be type asserted back to their original type
+type Observer func(Event)
+
+func (o Observer) observe(e Event) {
+	if o != nil {
+		o(e)
+	}
+}
+
+// observeWriter reports when w is closed, if there is an observer
+func (o Observer) observeWriter(w io.WriteCloser, e Event) io.WriteCloser {
+	if o == nil {
+		return w
+	}
+	return observedWriter{WriteCloser: w, observer: o, event: e}
+}
+
+// observeReader reports when r is closed, if there is an observer
+func (o Observer) observeReader(r io.ReadCloser, e Event) io.ReadCloser {
+	if o == nil {
+		return r
+	}
+	return observedReader{ReadCloser: r, observer: o, event: e}
+}
+
+type observedWriter struct {
+	io.WriteCloser
+	observer Observer
+	event    Event
+}
+
+func (w observedWriter) Close() error {
+	err := w.WriteCloser.Close()
+	w.close(err)
+	return err
+}
+
+func (w observedWriter) Abort(err error) error {
+	err = Abort(w.WriteCloser, err)
+	w.close(err)
+	return err
+}
+
+func (w observedWriter) close(err error) {
+	e := w.event
+	e.Op = OpClose
+	e.Err = err
+	w.observer(e)
+}
+
+type observedReader struct {
+	io.ReadCloser
+	observer Observer
+	event    Event
+}
+
+func (r observedReader) Close() error {
+	err := r.ReadCloser.Close()
+	e := r.event
+	e.Op = OpClose
+	e.Err = err
+	r.observer(e)
+	return err
+}
@@ -0,0 +1,64 @@
+package chain_test
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/conradludgate/chain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserver(t *testing.T) {
+	dir := t.TempDir()
+	var events []chain.Event
+	observer := func(e chain.Event) { events = append(events, e) }
+
+	osFS := chain.OS{RootDir: dir, Observer: observer}
+	path := filepath.Join(dir, "hello.txt")
+
+	wfs := chain.NewWriteBuilder(RemoveABC).
+		Then(ToLower).
+		Observe(observer).
+		WritingToFS(osFS)
+	w, err := wfs.Create("hello.txt")
+	require.Nil(t, err)
+	_, err = io.WriteString(w, "HELLO WORLD")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	require.Nil(t, wfs.Close())
+
+	assert.Equal(t, []chain.Event{
+		{Op: chain.OpCreate, Path: path, Stage: -1},
+		{Op: chain.OpCreate, Path: "hello.txt", Stage: -1},
+		{Op: chain.OpStage, Stage: 1},
+		{Op: chain.OpStage, Stage: 0},
+		{Op: chain.OpClose, Stage: 1},
+		{Op: chain.OpClose, Stage: 0},
+		{Op: chain.OpClose, Path: path, Stage: -1},
+	}, events)
+
+	events = nil
+	r, err := chain.ReadingFromFS(osFS).
+		Observe(observer).
+		Then(ToUpper).
+		Open("hello.txt").
+		Finally(RemoveXYZ)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+	assert.Equal(t, "HELLO WORLD", string(b))
+
+	assert.Equal(t, []chain.Event{
+		{Op: chain.OpOpen, Path: path, Stage: -1},
+		{Op: chain.OpOpen, Path: "hello.txt", Stage: -1},
+		{Op: chain.OpStage, Stage: 0},
+		{Op: chain.OpStage, Stage: 0},
+		{Op: chain.OpClose, Path: path, Stage: -1},
+		{Op: chain.OpClose, Stage: 0},
+		{Op: chain.OpClose, Stage: 0},
+	}, events)
+}
@@ -1,25 +1,249 @@
 package chain
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
 )
 
+// ErrUnsafePath is returned by OS when a name would resolve
+// to a file outside of its RootDir
+var ErrUnsafePath = errors.New("chain: path escapes root directory")
+
+// OS is a ReadFS and WriteFS of the files in RootDir.
+//
+// Names are confined to RootDir. Names that would resolve outside of it,
+// such as "../../etc/passwd" or through a symlink that points outside of RootDir,
+// are rejected with an *fs.PathError wrapping ErrUnsafePath.
+// This makes it safe to use with names from untrusted archives.
+// Note that a symlink created between the check and the file being opened isn't detected.
+//
+// If Atomic is set, Create writes to a temporary file in the same directory
+// which is synced and renamed over name when closed, so name is only ever
+// replaced by a complete file. When the file is the end of a WriterBuilder,
+// it is only renamed if every stage of the chain closes successfully,
+// and the temporary file is removed otherwise.
 type OS struct {
 	RootDir string
+	Atomic  bool
+
+	// Observer, if set, is told when files are opened, created and closed
+	Observer Observer
+}
+
+func (o OS) root() string {
+	if o.RootDir == "" {
+		return "."
+	}
+	return o.RootDir
+}
+
+// resolve joins name to RootDir, checking that neither the name
+// nor any symlinks along the way escape RootDir
+func (o OS) resolve(op, name string) (string, error) {
+	unsafe := &fs.PathError{Op: op, Path: name, Err: ErrUnsafePath}
+
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || !withinRoot(clean) {
+		return "", unsafe
+	}
+	path := filepath.Join(o.root(), clean)
+
+	realRoot, err := filepath.EvalSymlinks(o.root())
+	if err != nil {
+		return "", err
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the deepest part of the path that exists,
+	// as the file itself might be about to be created
+	existing := path
+	for {
+		realPath, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			realPath, err = filepath.Abs(realPath)
+			if err != nil {
+				return "", err
+			}
+			rel, err := filepath.Rel(realRoot, realPath)
+			if err != nil || !withinRoot(rel) {
+				return "", unsafe
+			}
+			return path, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, nil
+		}
+		existing = parent
+	}
+}
+
+// withinRoot reports whether a clean relative path stays inside its root
+func withinRoot(rel string) bool {
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 func (o OS) Open(name string) (io.ReadCloser, error) {
-	path := filepath.Join(o.RootDir, name)
-	return os.Open(path)
+	path, err := o.resolve("open", name)
+	if err != nil {
+		o.Observer.observe(Event{Op: OpOpen, Path: name, Stage: -1, Err: err})
+		return nil, err
+	}
+	f, err := os.Open(path)
+	o.Observer.observe(Event{Op: OpOpen, Path: path, Stage: -1, Err: err})
+	if err != nil {
+		return nil, err
+	}
+	return o.Observer.observeReader(f, Event{Path: path, Stage: -1}), nil
+}
+
+func (o OS) Stat(name string) (fs.FileInfo, error) {
+	if _, err := o.resolve("stat", name); err != nil {
+		return nil, err
+	}
+	return fs.Stat(o.dirFS(), name)
+}
+
+func (o OS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if _, err := o.resolve("readdir", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(o.dirFS(), name)
+}
+
+func (o OS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(o.dirFS(), pattern)
+}
+
+func (o OS) dirFS() fs.FS {
+	return os.DirFS(o.root())
 }
 
 func (o OS) Close() error { return nil }
 
 func (o OS) Create(name string) (io.WriteCloser, error) {
-	path := filepath.Join(o.RootDir, name)
-	fmt.Println("open", path)
-	return os.Create(path)
+	path, err := o.resolve("create", name)
+	if err != nil {
+		o.Observer.observe(Event{Op: OpCreate, Path: name, Stage: -1, Err: err})
+		return nil, err
+	}
+
+	var f io.WriteCloser
+	if o.Atomic {
+		f, err = createAtomic(path)
+	} else {
+		f, err = os.Create(path)
+	}
+	o.Observer.observe(Event{Op: OpCreate, Path: path, Stage: -1, Err: err})
+	if err != nil {
+		return nil, err
+	}
+	return o.Observer.observeWriter(f, Event{Path: path, Stage: -1}), nil
+}
+
+// atomicFile is a temporary file that replaces path once it has been
+// completely written
+type atomicFile struct {
+	f    *os.File
+	path string
+	err  error
+	// done is set atomically, as a chain written with a context
+	// aborts its sink from another goroutine when it's cancelled
+	done int32
+}
+
+func createAtomic(path string) (*atomicFile, error) {
+	dir, base := filepath.Split(path)
+	var suffix [6]byte
+	for i := 0; i < 100; i++ {
+		if _, err := rand.Read(suffix[:]); err != nil {
+			return nil, err
+		}
+		tmp := filepath.Join(dir, "."+base+".tmp-"+hex.EncodeToString(suffix[:]))
+		// unlike os.CreateTemp, this respects the umask like os.Create does
+		f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &atomicFile{f: f, path: path}, nil
+	}
+	return nil, &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+}
+
+func (a *atomicFile) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&a.done) != 0 {
+		return 0, fs.ErrClosed
+	}
+	n, err := a.f.Write(p)
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+	return n, err
+}
+
+// Close syncs the temporary file and renames it over path.
+// If any write failed, the file is discarded instead
+func (a *atomicFile) Close() error {
+	if atomic.LoadInt32(&a.done) != 0 {
+		return nil
+	}
+	if a.err != nil {
+		a.Abort(a.err)
+		return a.err
+	}
+	if !atomic.CompareAndSwapInt32(&a.done, 0, 1) {
+		return nil
+	}
+
+	tmp := a.f.Name()
+	err := JoinErrors(a.f.Sync(), a.f.Close())
+	if err == nil {
+		err = os.Rename(tmp, a.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(a.path))
+}
+
+// Abort removes the temporary file, leaving path untouched
+func (a *atomicFile) Abort(error) error {
+	if !atomic.CompareAndSwapInt32(&a.done, 0, 1) {
+		return nil
+	}
+	a.f.Close()
+	return os.Remove(a.f.Name())
+}
+
+// syncDir makes sure a rename in dir has been persisted
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = JoinErrors(d.Sync(), d.Close())
+	// not every platform can sync a directory
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, fs.ErrPermission) {
+		return nil
+	}
+	return err
 }
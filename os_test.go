@@ -0,0 +1,135 @@
+package chain_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/conradludgate/chain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOS_UnsafePaths(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "sub"), 0o755))
+	require.Nil(t, os.MkdirAll(outside, 0o755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, "sub", "inside.txt"), []byte("inside"), 0o600))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o600))
+	require.Nil(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret-link")))
+	require.Nil(t, os.Symlink(outside, filepath.Join(root, "outside-link")))
+	require.Nil(t, os.Symlink("sub", filepath.Join(root, "sub-link")))
+
+	osFS := chain.OS{RootDir: root}
+
+	for _, name := range []string{
+		"../outside/secret.txt",
+		"sub/../../outside/secret.txt",
+		"/etc/passwd",
+		"secret-link",
+		"outside-link/secret.txt",
+	} {
+		_, err := osFS.Open(name)
+		assert.ErrorIs(t, err, chain.ErrUnsafePath, name)
+	}
+
+	for _, name := range []string{
+		"../new.txt",
+		"outside-link/new.txt",
+		"outside-link/missing/new.txt",
+	} {
+		_, err := osFS.Create(name)
+		assert.ErrorIs(t, err, chain.ErrUnsafePath, name)
+	}
+	_, err := os.Stat(filepath.Join(outside, "new.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = osFS.ReadDir("outside-link")
+	assert.ErrorIs(t, err, chain.ErrUnsafePath)
+
+	// paths and symlinks that stay inside the root are fine
+	for _, name := range []string{"sub/inside.txt", "sub/../sub/inside.txt", "sub-link/inside.txt"} {
+		r, err := osFS.Open(name)
+		require.Nil(t, err, name)
+		b, err := ioutil.ReadAll(r)
+		require.Nil(t, err)
+		require.Nil(t, r.Close())
+		assert.Equal(t, "inside", string(b))
+	}
+
+	w, err := osFS.Create("sub-link/new.txt")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+}
+
+func TestOS_Atomic(t *testing.T) {
+	dir := t.TempDir()
+	osFS := chain.OS{RootDir: dir, Atomic: true}
+	path := filepath.Join(dir, "hello.txt")
+	require.Nil(t, ioutil.WriteFile(path, []byte("old"), 0o600))
+
+	write := func(wc chain.WriteChain) error {
+		f, err := osFS.Create("hello.txt")
+		require.Nil(t, err)
+		w, err := chain.NewWriteBuilder(wc).WritingTo(f)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "HELLO World"); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+	assertContents := func(expected string) {
+		b, err := ioutil.ReadFile(path)
+		require.Nil(t, err)
+		assert.Equal(t, expected, string(b))
+
+		entries, err := os.ReadDir(dir)
+		require.Nil(t, err)
+		assert.Len(t, entries, 1, "temporary file left behind")
+	}
+
+	// the file isn't replaced until it is closed
+	f, err := osFS.Create("hello.txt")
+	require.Nil(t, err)
+	_, err = io.WriteString(f, "partial")
+	require.Nil(t, err)
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, "old", string(b))
+	require.Nil(t, f.Close())
+	assertContents("partial")
+
+	require.Nil(t, write(ToLower))
+	assertContents("hello world")
+
+	failClose := func(w io.WriteCloser) (io.WriteCloser, error) {
+		return chain.WriteCloser2{WriteCloser: w, Closer: closerFunc(func() error { return io.ErrShortWrite })}, nil
+	}
+	assert.ErrorIs(t, write(failClose), io.ErrShortWrite)
+	assertContents("hello world")
+
+	failBuild := func(w io.WriteCloser) (io.WriteCloser, error) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	assert.ErrorIs(t, write(failBuild), io.ErrUnexpectedEOF)
+	assertContents("hello world")
+
+	f, err = osFS.Create("hello.txt")
+	require.Nil(t, err)
+	w, err := chain.NewWriteBuilder(ToLower).WritingTo(f)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, "partial")
+	require.Nil(t, err)
+	require.Nil(t, chain.Abort(w, io.ErrUnexpectedEOF))
+	assertContents("hello world")
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
@@ -0,0 +1,118 @@
+package chain_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/cipher/pgp"
+	"github.com/conradludgate/chain/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEntity(t *testing.T, name string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024})
+	require.Nil(t, err)
+	return e
+}
+
+func TestPGP_Symmetric(t *testing.T) {
+	pgpCfg := pgp.Config{Passphrase: []byte("change this pass")}
+	gzip := compress.GZIPConfig{}
+
+	output := bytes.NewBuffer(nil)
+
+	w, err := chain.NewWriteBuilder(pgpCfg.Encrypt).
+		Then(gzip.Compress).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, "hello world")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	r, err := chain.ReadingFrom(io.NopCloser(output)).
+		Then(gzip.Decompress).
+		Finally(pgpCfg.Decrypt)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, r.Close())
+
+	assert.Equal(t, "hello world", string(b))
+}
+
+func TestPGP_PublicKey(t *testing.T) {
+	alice := newEntity(t, "alice")
+	bob := newEntity(t, "bob")
+
+	ciphertext := encrypt(t, pgp.Config{
+		Recipients: openpgp.EntityList{bob},
+		Signer:     alice,
+	}.Encrypt, "hello world")
+
+	b, err := decrypt(pgp.Config{
+		Keyring: openpgp.EntityList{alice, bob},
+	}.Verify, ciphertext)
+	require.Nil(t, err)
+	assert.Equal(t, "hello world", string(b))
+
+	_, err = decrypt(pgp.Config{
+		Keyring: openpgp.EntityList{bob},
+	}.Verify, ciphertext)
+	assert.Equal(t, pgp.ErrUnknownSigner, err)
+}
+
+func TestPGP_Sign(t *testing.T) {
+	alice := newEntity(t, "alice")
+	verify := pgp.Config{Keyring: openpgp.EntityList{alice}}.Verify
+
+	signed := encrypt(t, pgp.Config{Signer: alice}.Sign, "hello world")
+
+	b, err := decrypt(verify, signed)
+	require.Nil(t, err)
+	assert.Equal(t, "hello world", string(b))
+
+	i := bytes.Index(signed, []byte("hello"))
+	require.NotEqual(t, -1, i)
+	tampered := append([]byte(nil), signed...)
+	tampered[i] = 'j'
+	_, err = decrypt(verify, tampered)
+	assert.Error(t, err)
+
+	unsigned := encrypt(t, pgp.Config{Passphrase: []byte("pass")}.Encrypt, "hello world")
+	_, err = decrypt(pgp.Config{Passphrase: []byte("pass")}.Verify, unsigned)
+	assert.Equal(t, pgp.ErrUnsigned, err)
+}
+
+func TestPGP_DetachSign(t *testing.T) {
+	alice := newEntity(t, "alice")
+	sig := bytes.NewBuffer(nil)
+
+	output := encrypt(t, pgp.Config{Signer: alice, SignatureOut: sig}.DetachSign, "hello world")
+	assert.Equal(t, "hello world", string(output))
+
+	verify := func(input string) ([]byte, error) {
+		return decrypt(pgp.Config{
+			Keyring:     openpgp.EntityList{alice},
+			SignatureIn: bytes.NewReader(sig.Bytes()),
+		}.VerifyDetached, []byte(input))
+	}
+
+	b, err := verify("hello world")
+	require.Nil(t, err)
+	assert.Equal(t, "hello world", string(b))
+
+	_, err = verify("jello world")
+	assert.Error(t, err)
+
+	_, err = decrypt(pgp.Config{
+		Keyring:     openpgp.EntityList{newEntity(t, "bob")},
+		SignatureIn: bytes.NewReader(sig.Bytes()),
+	}.VerifyDetached, []byte("hello world"))
+	assert.Equal(t, pgp.ErrUnknownSigner, err)
+}
@@ -1,14 +1,21 @@
 package chain
 
 import (
+	"context"
+	"fmt"
 	"io"
+	iofs "io/fs"
 )
 
 // ReaderBuilder lets you build a chain of io.Readers
 // in a more natural way
 type ReaderBuilder struct {
-	r   io.ReadCloser
-	err error
+	r        io.ReadCloser
+	err      error
+	chains   []ReadChain
+	stages   []Stage
+	observer Observer
+	ctx      context.Context
 }
 
 // ReadChain represents a common pattern in go packages.
@@ -29,32 +36,89 @@ func ReadingFrom(r io.ReadCloser) *ReaderBuilder {
 	return &ReaderBuilder{r: r}
 }
 
+// Observe sets an Observer to be told when each stage
+// added after it is built and closed.
+// Returns self
+func (chain *ReaderBuilder) Observe(observer Observer) *ReaderBuilder {
+	chain.observer = observer
+	return chain
+}
+
 // Then adds the next ReadChain to the current builder chain
 func (chain *ReaderBuilder) Then(next ReadChain) *ReaderBuilder {
+	stage := len(chain.chains)
+	chain.chains = append(chain.chains, next)
+	chain.stages = append(chain.stages, Stage{})
+
 	if chain.err == nil {
 		r, err := next(chain.r)
+		chain.observer.observe(Event{Op: OpStage, Stage: stage, Err: err})
 		if err != nil {
 			chain.r.Close()
-			chain.err = err
+			chain.err = stageError(stage, "", "", err)
 		} else {
-			chain.r = r
+			chain.r = chain.observer.observeReader(r, Event{Stage: stage})
 		}
 	}
 	return chain
 }
 
+// Named names the last ReadChain added to the builder, such as
+// Named("gzip", "level", "9"). keyvals are pairs of keys and values
+// describing how the stage is configured.
+// Returns self
+func (chain *ReaderBuilder) Named(name string, keyvals ...string) *ReaderBuilder {
+	chain.name(newStage(name, keyvals))
+	return chain
+}
+
+func (chain *ReaderBuilder) name(stage Stage) {
+	last := len(chain.stages) - 1
+	if last < 0 {
+		return
+	}
+	chain.stages[last] = stage
+
+	// the stage has already been built, so name the error if it failed
+	if se, ok := chain.err.(*StageError); ok && se.Stage == last && se.Name == "" {
+		named := *se
+		named.Name = stage.Name
+		chain.err = &named
+	}
+}
+
+// Describe returns the stages of the chain, in the order they were added
+func (chain *ReaderBuilder) Describe() []Stage {
+	stages := make([]Stage, len(chain.chains))
+	for i, next := range chain.chains {
+		stages[i] = describe(chain.stages[i], next)
+	}
+	return stages
+}
+
+// String describes the chain, such as "gzip(level=9) -> ToUpper"
+func (chain *ReaderBuilder) String() string {
+	return describeStages(chain.Describe())
+}
+
 // Finally adds the last ReadChain to the current builder chain,
 // then builds it into an io.ReadCloser
 func (chain *ReaderBuilder) Finally(next ReadChain) (io.ReadCloser, error) {
 	chain.Then(next)
+	if chain.err == nil && chain.ctx != nil {
+		// stages can have data buffered, so the source isn't always read from
+		chain.r = contextReader{ReadCloser: chain.r, ctx: chain.ctx}
+	}
 	return chain.r, chain.err
 }
 
 type ReadFSChain func(io.ReadCloser) (ReadFS, error)
 type ReaderFSBuilder struct {
-	first *ReaderBuilder
-	fs    ReadFSChain
-	after []ReadChain
+	first       *ReaderBuilder
+	fs          ReadFSChain
+	fsStage     Stage
+	after       []ReadChain
+	afterStages []Stage
 }
 
 func ReadingFromFS(fs ReadFS) *ReaderFSBuilder {
@@ -62,8 +126,9 @@ func ReadingFromFS(fs ReadFS) *ReaderFSBuilder {
 		first: &ReaderBuilder{
 			r: io.NopCloser(nil),
 		},
-		fs:    func(io.ReadCloser) (ReadFS, error) { return fs, nil },
-		after: nil,
+		fs:      func(io.ReadCloser) (ReadFS, error) { return fs, nil },
+		fsStage: Stage{Name: fmt.Sprintf("%T", fs)},
+		after:   nil,
 	}
 }
 
@@ -75,27 +140,65 @@ func (chain *ReaderBuilder) AsFS(next ReadFSChain) *ReaderFSBuilder {
 	}
 }
 
+// Observe sets an Observer to be told when files are opened,
+// and when the stages added after it are built and closed.
+// Returns self
+func (chain *ReaderFSBuilder) Observe(observer Observer) *ReaderFSBuilder {
+	chain.first.observer = observer
+	return chain
+}
+
 func (chain *ReaderFSBuilder) Open(name string) *ReaderBuilder {
+	observer := chain.first.observer
 	fs, err := chain.build()
 	if err != nil {
-		return &ReaderBuilder{err: err}
+		return &ReaderBuilder{err: stageError(-1, "", name, err), observer: observer}
 	}
 	r, err := fs.Open(name)
 	if err != nil {
 		fs.Close()
-		return &ReaderBuilder{err: err}
+		return &ReaderBuilder{err: stageError(-1, "", name, err), observer: observer}
 	}
 	return &ReaderBuilder{r: ReadCloser2{
 		ReadCloser: r,
-		Closer:     fs.fs,
-	}}
+		Closer:     fs,
+	}, observer: observer, ctx: chain.first.ctx}
 }
 
 func (chain *ReaderFSBuilder) Then(next ReadChain) *ReaderFSBuilder {
 	chain.after = append(chain.after, next)
+	chain.afterStages = append(chain.afterStages, Stage{})
+	return chain
+}
+
+// Named names the last ReadChain added to the builder,
+// or the ReadFSChain if none have been added since AsFS.
+// Returns self
+func (chain *ReaderFSBuilder) Named(name string, keyvals ...string) *ReaderFSBuilder {
+	if len(chain.after) == 0 {
+		chain.fsStage = newStage(name, keyvals)
+	} else {
+		chain.afterStages[len(chain.afterStages)-1] = newStage(name, keyvals)
+	}
 	return chain
 }
 
+// Describe returns the stages of the chain, in the order they were added,
+// including the ReadFSChain
+func (chain *ReaderFSBuilder) Describe() []Stage {
+	stages := chain.first.Describe()
+	stages = append(stages, describe(chain.fsStage, chain.fs))
+	for i, next := range chain.after {
+		stages = append(stages, describe(chain.afterStages[i], next))
+	}
+	return stages
+}
+
+// String describes the chain, such as "chain.OS -> gzip(level=9)"
+func (chain *ReaderFSBuilder) String() string {
+	return describeStages(chain.Describe())
+}
+
 func (chain *ReaderFSBuilder) Finally(next ReadChain) (ReadFS, error) {
 	return chain.Then(next).build()
 }
@@ -107,39 +210,105 @@ func (chain *ReaderFSBuilder) build() (*readFS, error) {
 
 	fs, err := chain.fs(chain.first.r)
 	if err != nil {
-		return nil, err
+		return nil, stageError(len(chain.first.chains), chain.fsStage.Name, "", err)
 	}
 
 	return &readFS{
-		Closer: chain.first.r,
-		fs:     fs,
-		after:  chain.after,
+		close:    chain.first.r,
+		fs:       fs,
+		after:    chain.after,
+		stages:   chain.afterStages,
+		observer: chain.first.observer,
+		ctx:      chain.first.ctx,
 	}, nil
 }
 
 type readFS struct {
-	io.Closer
-	fs    ReadFS
-	after []ReadChain
+	close    io.Closer
+	fs       ReadFS
+	after    []ReadChain
+	stages   []Stage
+	observer Observer
+	// ctx, if set, is used for each file, as with ReadingFromContext
+	ctx context.Context
 }
 
 func (fs *readFS) Open(path string) (io.ReadCloser, error) {
 	r, err := fs.fs.Open(path)
+	fs.observer.observe(Event{Op: OpOpen, Path: path, Stage: -1, Err: err})
 	if err != nil {
-		return nil, err
+		return nil, stageError(-1, "", path, err)
 	}
 
 	builder := ReadingFrom(r)
-	for _, then := range fs.after {
+	if fs.ctx != nil {
+		builder = ReadingFromContext(fs.ctx, r)
+	}
+	builder.Observe(fs.observer)
+	for i, then := range fs.after {
 		builder.Then(then)
+		if fs.stages[i].Name != "" {
+			builder.name(fs.stages[i])
+		}
 	}
 	if builder.err != nil {
-		return nil, builder.err
+		return nil, stageError(-1, "", path, builder.err)
 	}
 
+	if fs.ctx != nil {
+		return contextReader{ReadCloser: builder.r, ctx: fs.ctx}, nil
+	}
 	return builder.r, nil
 }
 
+// Stat describes the file in the underlying ReadFS.
+// If files are read through a chain, their size can't be known
+// without reading them, so it is reported as -1
+func (fs *readFS) Stat(name string) (iofs.FileInfo, error) {
+	sfs, ok := fs.fs.(StatFS)
+	if !ok {
+		return nil, &iofs.PathError{Op: "stat", Path: name, Err: ErrNotSupported}
+	}
+	info, err := sfs.Stat(name)
+	if err != nil || len(fs.after) == 0 || info.IsDir() {
+		return info, err
+	}
+	return unsizedInfo{info}, nil
+}
+
+// ReadDir lists the files in the underlying ReadFS, with their sizes reported as in Stat
+func (fs *readFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	rdfs, ok := fs.fs.(ReadDirFS)
+	if !ok {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: ErrNotSupported}
+	}
+	entries, err := rdfs.ReadDir(name)
+	if err != nil || len(fs.after) == 0 {
+		return entries, err
+	}
+	for i, entry := range entries {
+		if !entry.IsDir() {
+			entries[i] = unsizedEntry{entry}
+		}
+	}
+	return entries, nil
+}
+
+func (fs *readFS) Glob(pattern string) ([]string, error) {
+	if gfs, ok := fs.fs.(GlobFS); ok {
+		return gfs.Glob(pattern)
+	}
+	return nil, ErrNotSupported
+}
+
+func (fs *readFS) Close() error {
+	return closeAll(fs.fs, fs.close)
+}
+
+// ReadFS is a file system that files can be read from.
+//
+// A ReadFS can optionally be a StatFS, ReadDirFS or GlobFS
+// to describe, list and search for the files in it.
 type ReadFS interface {
 	Open(path string) (io.ReadCloser, error)
 	io.Closer
@@ -151,12 +320,7 @@ type ReadCloser2 struct {
 }
 
 func (wc ReadCloser2) Close() error {
-	err1 := wc.ReadCloser.Close()
-	err2 := wc.Closer.Close()
-	if err1 != nil {
-		return err1
-	}
-	return err2
+	return closeAll(wc.ReadCloser, wc.Closer)
 }
 
 type ReadCloser struct {
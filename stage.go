@@ -0,0 +1,84 @@
+package chain
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Stage describes a stage in a chain, for logging and debugging.
+//
+// Stages that haven't been given a name with Named are described
+// by the name of the function they were built from, such as
+// "compress.(*GZIPConfig).Compress"
+type Stage struct {
+	Name   string
+	Params map[string]string
+}
+
+// newStage makes a Stage from a name and pairs of keys and values.
+// A key without a value is given an empty one
+func newStage(name string, keyvals []string) Stage {
+	stage := Stage{Name: name}
+	if len(keyvals) > 0 {
+		stage.Params = make(map[string]string, (len(keyvals)+1)/2)
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		var value string
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		stage.Params[keyvals[i]] = value
+	}
+	return stage
+}
+
+// String formats the stage like gzip(level=9), with the params sorted by key
+func (s Stage) String() string {
+	if len(s.Params) == 0 {
+		return s.Name
+	}
+	keys := make([]string, 0, len(s.Params))
+	for k := range s.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, len(keys))
+	for i, k := range keys {
+		params[i] = k + "=" + s.Params[k]
+	}
+	return s.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// describe returns the stage, falling back to the name of f if it hasn't been named
+func describe(stage Stage, f interface{}) Stage {
+	if stage.Name == "" {
+		stage.Name = funcName(f)
+	}
+	return stage
+}
+
+// funcName is the name of the function f, without its package path
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	// method values are suffixed with -fm
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// describeStages formats stages as a pipeline, in the order they were added
+func describeStages(stages []Stage) string {
+	s := make([]string, len(stages))
+	for i, stage := range stages {
+		s[i] = stage.String()
+	}
+	return strings.Join(s, " -> ")
+}
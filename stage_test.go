@@ -0,0 +1,52 @@
+package chain_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/archive"
+	"github.com/conradludgate/chain/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribe(t *testing.T) {
+	gzip := compress.GZIPConfig{}
+	zip := archive.ZipConfig{}
+
+	wb := chain.NewWriteBuilder(ToLower).
+		Then(gzip.Compress).Named("gzip", "level", "9", "mtime", "0")
+	assert.Equal(t, []chain.Stage{
+		{Name: "chain_test.ToLower"},
+		{Name: "gzip", Params: map[string]string{"level": "9", "mtime": "0"}},
+	}, wb.Describe())
+	assert.Equal(t, "chain_test.ToLower -> gzip(level=9, mtime=0)", wb.String())
+
+	wfs := chain.NewWriteBuilder(ToLower).
+		IntoFS(zip.FSWriter).Named("zip").
+		Then(gzip.Compress)
+	assert.Equal(t, "chain_test.ToLower -> zip -> compress.(*GZIPConfig).Compress", wfs.String())
+
+	rfs := chain.ReadingFromFS(chain.OS{RootDir: "./example"}).
+		Then(ToUpper).Named("upper")
+	assert.Equal(t, "chain.OS -> upper", rfs.String())
+
+	rb := chain.ReadingFrom(io.NopCloser(strings.NewReader(inputLower))).
+		Then(ToUpper).
+		Then(gzip.Decompress).Named("gunzip")
+	assert.Equal(t, "chain_test.ToUpper -> gunzip", rb.String())
+
+	// names are included in errors, even when named after the stage fails
+	_, err := rb.Finally(RemoveXYZ)
+	assert.EqualError(t, err, "chain: stage 1 (gunzip): gzip: invalid header")
+
+	_, err = chain.NewWriteBuilder(ToLower).
+		Then(func(io.WriteCloser) (io.WriteCloser, error) { return nil, io.ErrClosedPipe }).Named("broken").
+		WritingTo(chain.NopWriteCloser{Writer: io.Discard})
+	var stageErr *chain.StageError
+	require.ErrorAs(t, err, &stageErr)
+	assert.Equal(t, "broken", stageErr.Name)
+	assert.Equal(t, 1, stageErr.Stage)
+}
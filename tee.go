@@ -0,0 +1,170 @@
+package chain
+
+import (
+	"io"
+	"io/fs"
+	"strconv"
+)
+
+// TeePolicy decides what a Tee does when one of its branches fails
+type TeePolicy int
+
+const (
+	// AbortOnError aborts every branch as soon as one of them fails.
+	// Branches are closed one after another, so if closing one fails, the branches after it
+	// are aborted, but those already closed have committed their output and can't be rolled back
+	AbortOnError TeePolicy = iota
+	// ContinueOnError aborts only the branch that failed, and keeps
+	// writing to the others. Writing only fails once every branch has failed
+	ContinueOnError
+)
+
+// Branch is one of the destinations of a Tee.
+// The data is written through Chain, if set, to To
+type Branch struct {
+	Chain *WriterBuilder
+	To    io.WriteCloser
+}
+
+// BranchError is an error from one of the branches of a Tee
+type BranchError struct {
+	Branch int
+	Err    error
+}
+
+func (e *BranchError) Error() string {
+	return "chain: tee branch " + strconv.Itoa(e.Branch) + ": " + e.Err.Error()
+}
+
+func (e *BranchError) Unwrap() error { return e.Err }
+
+// Tee builds each branch and returns a writer that writes to all of them,
+// such as to gzip to a local file and encrypt to a backup at the same time.
+// The branches are written to one after another, so nothing is buffered.
+//
+// Closing it closes every branch that hasn't failed, in order, and returns the errors of every
+// branch that failed, as BranchErrors. Under AbortOnError, once a branch fails to close,
+// the rest are aborted instead. The writer is also an Aborter, which aborts every branch.
+// If building a branch fails, the branches that have been built are aborted.
+func Tee(policy TeePolicy, branches ...Branch) (io.WriteCloser, error) {
+	t := &teeWriter{policy: policy, branches: make([]io.WriteCloser, len(branches))}
+	for i, b := range branches {
+		w := b.To
+		if b.Chain != nil {
+			var err error
+			w, err = b.Chain.WritingTo(b.To)
+			if err != nil {
+				for _, built := range t.branches[:i] {
+					Abort(built, err)
+				}
+				for _, unbuilt := range branches[i+1:] {
+					Abort(unbuilt.To, err)
+				}
+				return nil, &BranchError{Branch: i, Err: err}
+			}
+		}
+		t.branches[i] = w
+	}
+	return t, nil
+}
+
+type teeWriter struct {
+	policy TeePolicy
+	// branches that have failed are set to nil
+	branches []io.WriteCloser
+	errs     []error
+	done     bool
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if t.done {
+		return 0, fs.ErrClosed
+	}
+
+	alive := 0
+	for i, w := range t.branches {
+		if w == nil {
+			continue
+		}
+		n, err := w.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			alive++
+			continue
+		}
+
+		err = &BranchError{Branch: i, Err: err}
+		t.fail(i, err)
+		if t.policy == AbortOnError {
+			t.abort(err)
+			return 0, t.err()
+		}
+	}
+
+	if alive == 0 {
+		return 0, t.err()
+	}
+	return len(p), nil
+}
+
+// fail aborts branch i, and records the error it failed with
+func (t *teeWriter) fail(i int, err error) {
+	t.errs = append(t.errs, err)
+	if abortErr := Abort(t.branches[i], err); abortErr != nil {
+		t.errs = append(t.errs, &BranchError{Branch: i, Err: abortErr})
+	}
+	t.branches[i] = nil
+}
+
+// abort aborts every branch that hasn't already failed
+func (t *teeWriter) abort(err error) {
+	t.done = true
+	for i, w := range t.branches {
+		if w != nil {
+			if abortErr := Abort(w, err); abortErr != nil {
+				t.errs = append(t.errs, &BranchError{Branch: i, Err: abortErr})
+			}
+			t.branches[i] = nil
+		}
+	}
+}
+
+func (t *teeWriter) err() error {
+	if len(t.errs) == 0 {
+		return fs.ErrClosed
+	}
+	return JoinErrors(t.errs...)
+}
+
+func (t *teeWriter) Close() error {
+	if t.done {
+		return JoinErrors(t.errs...)
+	}
+	t.done = true
+
+	for i, w := range t.branches {
+		if w == nil {
+			continue
+		}
+		t.branches[i] = nil
+		if err := w.Close(); err != nil {
+			err = &BranchError{Branch: i, Err: closeError(w, err)}
+			t.errs = append(t.errs, err)
+			if t.policy == AbortOnError {
+				t.abort(err)
+				break
+			}
+		}
+	}
+	return JoinErrors(t.errs...)
+}
+
+func (t *teeWriter) Abort(err error) error {
+	if t.done {
+		return nil
+	}
+	t.abort(err)
+	return JoinErrors(t.errs...)
+}
@@ -0,0 +1,151 @@
+package chain_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/chaintest"
+	"github.com/conradludgate/chain/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errBroken = errors.New("broken")
+
+// brokenWriter fails every write
+type brokenWriter struct{ closed bool }
+
+func (*brokenWriter) Write([]byte) (int, error) { return 0, errBroken }
+func (w *brokenWriter) Close() error            { w.closed = true; return nil }
+
+// brokenCloser fails to close
+type brokenCloser struct{ chain.Buffer }
+
+func (*brokenCloser) Close() error { return errBroken }
+
+func TestTee(t *testing.T) {
+	gzip := compress.GZIPConfig{}
+
+	plain := &chain.Buffer{}
+	compressed := &chain.Buffer{}
+	w, err := chain.Tee(chain.AbortOnError,
+		chain.Branch{Chain: chain.NewWriteBuilder(ToLower), To: plain},
+		chain.Branch{Chain: chain.NewWriteBuilder(gzip.Compress), To: compressed},
+	)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", plain.String())
+	r, err := chain.ReadingFrom(io.NopCloser(compressed)).Finally(gzip.Decompress)
+	require.Nil(t, err)
+	b, err := io.ReadAll(r)
+	require.Nil(t, err)
+	assert.Equal(t, inputUpper, string(b))
+
+	// a tee of one branch is a stage like any other
+	assert.Nil(t, chaintest.TestWriteChain(func(w io.WriteCloser) (io.WriteCloser, error) {
+		return chain.Tee(chain.AbortOnError, chain.Branch{Chain: chain.NewWriteBuilder(ToLower), To: w})
+	}))
+}
+
+func TestTee_AbortOnError(t *testing.T) {
+	ok := &chain.Buffer{}
+	broken := &brokenWriter{}
+	w, err := chain.Tee(chain.AbortOnError,
+		chain.Branch{To: ok},
+		chain.Branch{To: broken},
+	)
+	require.Nil(t, err)
+
+	_, err = io.WriteString(w, inputUpper)
+	assert.ErrorIs(t, err, errBroken)
+	var be *chain.BranchError
+	require.ErrorAs(t, err, &be)
+	assert.Equal(t, 1, be.Branch)
+
+	// the other branch was aborted too
+	assert.Equal(t, 0, ok.Len())
+	assert.True(t, broken.closed)
+
+	assert.ErrorIs(t, w.Close(), errBroken)
+}
+
+func TestTee_AbortOnError_Close(t *testing.T) {
+	committed := &chain.Buffer{}
+	pending := &chain.Buffer{}
+	w, err := chain.Tee(chain.AbortOnError,
+		chain.Branch{To: committed},
+		chain.Branch{To: &brokenCloser{}},
+		chain.Branch{To: pending},
+	)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+
+	err = w.Close()
+	assert.ErrorIs(t, err, errBroken)
+	var be *chain.BranchError
+	require.ErrorAs(t, err, &be)
+	assert.Equal(t, 1, be.Branch)
+
+	// the branches after the one that failed are aborted,
+	// but the ones before it have already been committed
+	assert.Equal(t, 0, pending.Len())
+	assert.Equal(t, inputUpper, committed.String())
+}
+
+func TestTee_ContinueOnError(t *testing.T) {
+	ok := &chain.Buffer{}
+	broken := &brokenWriter{}
+	w, err := chain.Tee(chain.ContinueOnError,
+		chain.Branch{To: broken},
+		chain.Branch{Chain: chain.NewWriteBuilder(ToLower), To: ok},
+	)
+	require.Nil(t, err)
+
+	n, err := io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+	assert.Equal(t, len(inputUpper), n)
+	assert.True(t, broken.closed)
+
+	_, err = io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+
+	// the failure is still reported
+	err = w.Close()
+	assert.ErrorIs(t, err, errBroken)
+	var be *chain.BranchError
+	require.ErrorAs(t, err, &be)
+	assert.Equal(t, 0, be.Branch)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz"+"abcdefghijklmnopqrstuvwxyz", ok.String())
+
+	// once every branch has failed, so does the tee
+	w, err = chain.Tee(chain.ContinueOnError, chain.Branch{To: &brokenWriter{}})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputUpper)
+	assert.ErrorIs(t, err, errBroken)
+}
+
+func TestTee_BuildError(t *testing.T) {
+	built := &chain.Buffer{}
+	built.WriteString("partial")
+	unbuilt := &brokenWriter{}
+	_, err := chain.Tee(chain.ContinueOnError,
+		chain.Branch{To: built},
+		chain.Branch{Chain: chain.NewWriteBuilder(func(io.WriteCloser) (io.WriteCloser, error) {
+			return nil, errBroken
+		}), To: &chain.Buffer{}},
+		chain.Branch{To: unbuilt},
+	)
+	assert.ErrorIs(t, err, errBroken)
+	var be *chain.BranchError
+	require.ErrorAs(t, err, &be)
+	assert.Equal(t, 1, be.Branch)
+
+	assert.Equal(t, 0, built.Len())
+	assert.True(t, unbuilt.closed)
+}
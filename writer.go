@@ -1,13 +1,18 @@
 package chain
 
 import (
+	"bytes"
 	"io"
+	iofs "io/fs"
+	"sync"
 )
 
 // WriterBuilder lets you build a chain of io.Writers
 // in a more natural way
 type WriterBuilder struct {
-	wcs []WriteChain
+	wcs      []WriteChain
+	stages   []Stage
+	observer Observer
 }
 
 // WriteChain represents a common pattern in go packages.
@@ -24,7 +29,8 @@ type WriteChain func(io.WriteCloser) (io.WriteCloser, error)
 // given WriteChain being the first in the chain
 func NewWriteBuilder(first WriteChain) *WriterBuilder {
 	return &WriterBuilder{
-		wcs: []WriteChain{first},
+		wcs:    []WriteChain{first},
+		stages: []Stage{{}},
 	}
 }
 
@@ -32,6 +38,40 @@ func NewWriteBuilder(first WriteChain) *WriterBuilder {
 // Returns self
 func (wc *WriterBuilder) Then(next WriteChain) *WriterBuilder {
 	wc.wcs = append(wc.wcs, next)
+	wc.stages = append(wc.stages, Stage{})
+	return wc
+}
+
+// Named names the last WriteChain added to the builder, such as
+// Named("gzip", "level", "9"). keyvals are pairs of keys and values
+// describing how the stage is configured.
+// Returns self
+func (wc *WriterBuilder) Named(name string, keyvals ...string) *WriterBuilder {
+	if len(wc.stages) > 0 {
+		wc.stages[len(wc.stages)-1] = newStage(name, keyvals)
+	}
+	return wc
+}
+
+// Describe returns the stages of the chain, in the order they were added
+func (wc *WriterBuilder) Describe() []Stage {
+	stages := make([]Stage, len(wc.wcs))
+	for i, next := range wc.wcs {
+		stages[i] = describe(wc.stages[i], next)
+	}
+	return stages
+}
+
+// String describes the chain, such as "ToLower -> gzip(level=9)"
+func (wc *WriterBuilder) String() string {
+	return describeStages(wc.Describe())
+}
+
+// Observe sets an Observer to be told when each stage
+// in the chain is built and closed.
+// Returns self
+func (wc *WriterBuilder) Observe(observer Observer) *WriterBuilder {
+	wc.observer = observer
 	return wc
 }
 
@@ -40,18 +80,176 @@ func (wc *WriterBuilder) Then(next WriteChain) *WriterBuilder {
 //
 // If w is a Closer type too, calling the returned writer's Close function
 // will also close w.
+//
+// The returned writer is an Aborter. Aborting it aborts every stage that is an Aborter,
+// then w. Stages that aren't Aborters are closed, so they release any resources
+// such as goroutines, but what they write as they close is discarded rather than written to w.
+// Writing to or closing the writer after aborting it returns the error it was aborted with.
+//
+// If w is an Aborter, such as a file created by OS in Atomic mode or a Buffer,
+// w is only closed once every stage in the chain has closed successfully.
+// If building the chain or closing any stage fails, w is aborted instead.
 func (wc *WriterBuilder) WritingTo(w io.WriteCloser) (io.WriteCloser, error) {
+	cw := &chainWriter{
+		sink:    w,
+		stages:  make([]io.WriteCloser, len(wc.wcs)),
+		outputs: make([]*stageOutput, len(wc.wcs)),
+	}
+	if _, ok := w.(Aborter); ok {
+		cw.deferred = true
+		w = NopWriteCloser{Writer: w}
+	}
+
 	for i := len(wc.wcs) - 1; i >= 0; i-- {
-		newW, err := wc.wcs[i](w)
+		cw.outputs[i] = &stageOutput{WriteCloser: w}
+		newW, err := wc.wcs[i](cw.outputs[i])
+		wc.observer.observe(Event{Op: OpStage, Stage: i, Err: err})
 		if err != nil {
 			w.Close()
-			return nil, err
+			if cw.deferred {
+				Abort(cw.sink, err)
+			}
+			return nil, stageError(i, wc.stages[i].Name, "", err)
 		}
 
-		w = newW
+		cw.stages[i] = newW
+		w = wc.observer.observeWriter(newW, Event{Stage: i})
 	}
 
-	return w, nil
+	cw.WriteCloser = w
+	return cw, nil
+}
+
+// Aborter is a writer or WriteFS that can be closed without finalising what was written to it,
+// such as a file that is removed rather than kept.
+// Abort is given the error that caused the abort.
+type Aborter interface {
+	Abort(err error) error
+}
+
+// Committer is a stage with something to do once the output of its chain has been committed,
+// such as hash.Config.Record writing a sidecar file. Once every stage, and the writer the chain
+// writes to, have closed successfully, the chain calls Commit on each stage that is a Committer.
+// It isn't called if closing fails, or the chain is aborted.
+type Committer interface {
+	Commit() error
+}
+
+// Abort aborts c if it is an Aborter, and closes it otherwise
+func Abort(c io.Closer, err error) error {
+	if a, ok := c.(Aborter); ok {
+		return a.Abort(err)
+	}
+	return c.Close()
+}
+
+// chainWriter is the result of WritingTo
+type chainWriter struct {
+	io.WriteCloser
+	stages []io.WriteCloser
+	// outputs are what each stage writes to
+	outputs []*stageOutput
+	sink    io.WriteCloser
+	// deferred is set if the sink is only closed once every stage has closed successfully
+	deferred bool
+	done     bool
+	// aborted is the error the chain was aborted with
+	aborted error
+}
+
+func (w *chainWriter) Write(p []byte) (int, error) {
+	if w.aborted != nil {
+		return 0, w.aborted
+	}
+	return w.WriteCloser.Write(p)
+}
+
+func (w *chainWriter) Close() error {
+	if w.done {
+		return w.aborted
+	}
+	w.done = true
+
+	err := w.WriteCloser.Close()
+	if w.deferred {
+		if err != nil {
+			return JoinErrors(err, closeError(w.sink, Abort(w.sink, err)))
+		}
+		err = closeError(w.sink, w.sink.Close())
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, stage := range w.stages {
+		if c, ok := stage.(Committer); ok {
+			errs = append(errs, closeError(stage, c.Commit()))
+		}
+	}
+	return JoinErrors(errs...)
+}
+
+func (w *chainWriter) Abort(err error) error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.aborted = err
+	if w.aborted == nil {
+		w.aborted = iofs.ErrClosed
+	}
+
+	for _, output := range w.outputs {
+		output.discard = true
+	}
+	var errs []error
+	for _, stage := range w.stages {
+		if a, ok := stage.(Aborter); ok {
+			errs = append(errs, closeError(stage, a.Abort(err)))
+		} else {
+			// what it writes is discarded, so it doesn't matter if closing it fails
+			stage.Close()
+		}
+	}
+	errs = append(errs, closeError(w.sink, Abort(w.sink, err)))
+	return JoinErrors(errs...)
+}
+
+// stageOutput is what a stage in a chain writes to.
+// Once the chain is aborted, it discards everything written to it,
+// and closing it does nothing, so the stages can be closed without finalising the output
+type stageOutput struct {
+	io.WriteCloser
+	discard bool
+}
+
+func (w *stageOutput) Write(p []byte) (int, error) {
+	if w.discard {
+		return len(p), nil
+	}
+	return w.WriteCloser.Write(p)
+}
+
+func (w *stageOutput) Close() error {
+	if w.discard {
+		return nil
+	}
+	return w.WriteCloser.Close()
+}
+
+// Buffer is an in-memory destination for a chain.
+// Unlike a NopWriteCloser around a bytes.Buffer, it is emptied if the chain is aborted,
+// so it never holds partial output
+type Buffer struct {
+	bytes.Buffer
+}
+
+func (b *Buffer) Close() error { return nil }
+
+func (b *Buffer) Abort(error) error {
+	b.Reset()
+	return nil
 }
 
 type WriterFileBuilder struct {
@@ -76,41 +274,73 @@ func (builder *WriterFileBuilder) InFS(next WriteFSChain) *WriterBuilder {
 		f, err := fs.Create(builder.name)
 		if err != nil {
 			fs.Close()
-			return nil, err
+			return nil, stageError(-1, "", builder.name, err)
 		}
 
+		// the file system doesn't close w itself
 		return WriteCloser2{
 			WriteCloser: f,
-			Closer:      fs,
+			Closer:      closers{fs, w},
 		}, nil
-	})
+	}).Named(funcName(next), "path", builder.name)
 }
 func (builder *WriterFileBuilder) WritingToFS(fs WriteFS) (io.WriteCloser, error) {
 	f, err := fs.Create(builder.name)
 	if err != nil {
 		fs.Close()
-		return nil, err
+		return nil, stageError(-1, "", builder.name, err)
 	}
 
-	return builder.builder.WritingTo(WriteCloser2{
+	w, err := builder.builder.WritingTo(fileSink{
 		WriteCloser: f,
-		Closer:      fs,
+		fs:          fs,
 	})
+	if err != nil {
+		return nil, stageError(-1, "", builder.name, err)
+	}
+	return w, nil
+}
+
+// fileSink is a file at the end of a chain, along with the WriteFS it was created in
+type fileSink struct {
+	io.WriteCloser
+	fs WriteFS
+}
+
+func (f fileSink) Close() error {
+	return WriteCloser2{WriteCloser: f.WriteCloser, Closer: f.fs}.Close()
+}
+
+func (f fileSink) Abort(err error) error {
+	return JoinErrors(
+		closeError(f.WriteCloser, Abort(f.WriteCloser, err)),
+		closeError(f.fs, Abort(f.fs, err)),
+	)
+}
+
+// closers closes each of its closers in order
+type closers []io.Closer
+
+func (c closers) Close() error {
+	return closeAll(c...)
 }
 
 type WriteFSBuilder struct {
-	first *WriterBuilder
-	fs    WriteFSChain
-	after *WriterBuilder
+	first   *WriterBuilder
+	fs      WriteFSChain
+	fsStage Stage
+	after   *WriterBuilder
 }
 
+// WriteFSChain makes a WriteFS that writes to the given writer, like archive.ZipConfig.FSWriter.
+// Closing the WriteFS doesn't need to close the writer, as the builders close it afterwards
 type WriteFSChain func(io.WriteCloser) (WriteFS, error)
 
 func (wc *WriterBuilder) IntoFS(next WriteFSChain) *WriteFSBuilder {
 	return &WriteFSBuilder{
 		first: wc,
 		fs:    next,
-		after: &WriterBuilder{},
+		after: &WriterBuilder{observer: wc.observer},
 	}
 }
 
@@ -119,6 +349,7 @@ func (wc *WriterBuilder) WritingToFS(fs WriteFS) WriteFS {
 		close: NopWriteCloser{},
 		first: wc,
 		fs:    fs,
+		sink:  true,
 	}
 }
 
@@ -127,6 +358,31 @@ func (wc *WriteFSBuilder) Then(next WriteChain) *WriteFSBuilder {
 	return wc
 }
 
+// Named names the last WriteChain added to the builder,
+// or the WriteFSChain if none have been added since IntoFS.
+// Returns self
+func (wc *WriteFSBuilder) Named(name string, keyvals ...string) *WriteFSBuilder {
+	if len(wc.after.wcs) == 0 {
+		wc.fsStage = newStage(name, keyvals)
+	} else {
+		wc.after.Named(name, keyvals...)
+	}
+	return wc
+}
+
+// Describe returns the stages of the chain, in the order they were added,
+// including the WriteFSChain
+func (wc *WriteFSBuilder) Describe() []Stage {
+	stages := wc.first.Describe()
+	stages = append(stages, describe(wc.fsStage, wc.fs))
+	return append(stages, wc.after.Describe()...)
+}
+
+// String describes the chain, such as "ToLower -> zip -> gzip(level=9)"
+func (wc *WriteFSBuilder) String() string {
+	return describeStages(wc.Describe())
+}
+
 func (wc *WriteFSBuilder) WritingTo(w io.WriteCloser) (WriteFS, error) {
 	after, err := wc.after.WritingTo(w)
 	if err != nil {
@@ -136,7 +392,7 @@ func (wc *WriteFSBuilder) WritingTo(w io.WriteCloser) (WriteFS, error) {
 	fs, err := wc.fs(after)
 	if err != nil {
 		after.Close()
-		return nil, err
+		return nil, stageError(len(wc.first.wcs), wc.fsStage.Name, "", err)
 	}
 
 	return &writeFs{
@@ -147,27 +403,108 @@ func (wc *WriteFSBuilder) WritingTo(w io.WriteCloser) (WriteFS, error) {
 }
 
 type writeFs struct {
-	close io.Closer
+	close io.WriteCloser
 	fs    WriteFS
 	first *WriterBuilder
+	// sink is set if fs is the end of the chain, rather than a stage in it
+	sink bool
+	done bool
+	// aborted is the error the file system was aborted with
+	aborted error
+
+	// files that have been created and not yet closed, which are aborted along with the file system
+	mu    sync.Mutex
+	files map[*fsFile]struct{}
 }
 
 func (fs *writeFs) Create(path string) (io.WriteCloser, error) {
+	if fs.aborted != nil {
+		return nil, stageError(-1, "", path, fs.aborted)
+	}
 	w, err := fs.fs.Create(path)
+	fs.first.observer.observe(Event{Op: OpCreate, Path: path, Stage: -1, Err: err})
 	if err != nil {
-		return nil, err
+		return nil, stageError(-1, "", path, err)
+	}
+
+	w, err = fs.first.WritingTo(w)
+	if err != nil {
+		return nil, stageError(-1, "", path, err)
+	}
+
+	f := &fsFile{WriteCloser: w, fs: fs}
+	fs.mu.Lock()
+	if fs.files == nil {
+		fs.files = make(map[*fsFile]struct{})
+	}
+	fs.files[f] = struct{}{}
+	fs.mu.Unlock()
+	return f, nil
+}
+
+// Abort aborts the file system, without finalising it, and whatever it writes to.
+// Files created in it that haven't been closed yet are aborted too, so closing them
+// afterwards doesn't commit them, and neither does closing the file system,
+// which returns the error it was aborted with
+func (fs *writeFs) Abort(err error) error {
+	if fs.done {
+		return nil
+	}
+	fs.done = true
+	fs.aborted = err
+	if fs.aborted == nil {
+		fs.aborted = iofs.ErrClosed
+	}
+
+	fs.mu.Lock()
+	files := fs.files
+	fs.files = nil
+	fs.mu.Unlock()
+	var errs []error
+	for f := range files {
+		errs = append(errs, Abort(f.WriteCloser, err))
 	}
 
-	return fs.first.WritingTo(w)
+	var err1 error
+	if a, ok := fs.fs.(Aborter); ok {
+		err1 = a.Abort(err)
+	} else if fs.sink {
+		err1 = fs.fs.Close()
+	}
+	err2 := Abort(fs.close, err)
+	errs = append(errs, closeError(fs.fs, err1), closeError(fs.close, err2))
+	return JoinErrors(errs...)
 }
 
 func (fs *writeFs) Close() error {
-	err1 := fs.fs.Close()
-	err2 := fs.close.Close()
-	if err1 != nil {
-		return err1
+	if fs.done {
+		return fs.aborted
 	}
-	return err2
+	fs.done = true
+	return closeAll(fs.fs, fs.close)
+}
+
+// fsFile is a file created in a writeFs, which is aborted along with it
+type fsFile struct {
+	io.WriteCloser
+	fs *writeFs
+}
+
+// forget stops the file system from aborting the file
+func (f *fsFile) forget() {
+	f.fs.mu.Lock()
+	delete(f.fs.files, f)
+	f.fs.mu.Unlock()
+}
+
+func (f *fsFile) Close() error {
+	f.forget()
+	return f.WriteCloser.Close()
+}
+
+func (f *fsFile) Abort(err error) error {
+	f.forget()
+	return Abort(f.WriteCloser, err)
 }
 
 type WriteFS interface {
@@ -187,10 +524,5 @@ type WriteCloser2 struct {
 }
 
 func (wc WriteCloser2) Close() error {
-	err1 := wc.WriteCloser.Close()
-	err2 := wc.Closer.Close()
-	if err1 != nil {
-		return err1
-	}
-	return err2
+	return closeAll(wc.WriteCloser, wc.Closer)
 }
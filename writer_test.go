@@ -1,11 +1,18 @@
 package chain_test
 
 import (
+	stdzip "archive/zip"
 	"bytes"
 	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/conradludgate/chain"
+	"github.com/conradludgate/chain/archive"
+	"github.com/conradludgate/chain/compress"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -75,3 +82,115 @@ func (r toLower) Write(p []byte) (n int, err error) {
 	}
 	return r.WriteCloser.Write(q)
 }
+
+func TestWriterAbort(t *testing.T) {
+	gzip := compress.GZIPConfig{}
+
+	// the gzip trailer isn't written when aborted
+	output := bytes.NewBuffer(nil)
+	w, err := chain.NewWriteBuilder(gzip.Compress).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+	require.Nil(t, chain.Abort(w, io.ErrUnexpectedEOF))
+
+	// nothing more reaches the output once it's aborted
+	n := output.Len()
+	_, err = io.WriteString(w, "after")
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, io.ErrUnexpectedEOF, w.Close())
+	assert.Equal(t, n, output.Len())
+
+	r, err := chain.ReadingFrom(io.NopCloser(output)).Finally(gzip.Decompress)
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// a Buffer is emptied
+	buf := &chain.Buffer{}
+	w, err = chain.NewWriteBuilder(ToLower).
+		Then(gzip.Compress).
+		WritingTo(buf)
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+	require.Nil(t, chain.Abort(w, io.ErrUnexpectedEOF))
+	assert.Equal(t, 0, buf.Len())
+
+	// and so are zip archives
+	buf = &chain.Buffer{}
+	wfs, err := chain.NewWriteBuilder(ToLower).
+		IntoFS(archive.ZipConfig{}.FSWriter).
+		Then(gzip.Compress).
+		WritingTo(buf)
+	require.Nil(t, err)
+	f, err := wfs.Create("hello.txt")
+	require.Nil(t, err)
+	_, err = io.WriteString(f, inputUpper)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	require.Nil(t, chain.Abort(wfs, io.ErrUnexpectedEOF))
+	assert.Equal(t, 0, buf.Len())
+
+	// even if they're closed afterwards
+	assert.Equal(t, io.ErrUnexpectedEOF, wfs.Close())
+	assert.Equal(t, 0, buf.Len())
+	_, err = wfs.Create("more.txt")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// or the file system isn't the one that was aborted
+	output = bytes.NewBuffer(nil)
+	zipFS, err := archive.ZipConfig{}.FSWriter(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	f, err = zipFS.Create("hello.txt")
+	require.Nil(t, err)
+	_, err = io.WriteString(f, inputUpper)
+	require.Nil(t, err)
+	require.Nil(t, chain.Abort(zipFS, io.ErrUnexpectedEOF))
+	assert.ErrorIs(t, zipFS.Close(), fs.ErrClosed)
+	_, err = stdzip.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	assert.Error(t, err)
+}
+
+func TestWriterAbort_ClosesStages(t *testing.T) {
+	// stages that can't be aborted are closed, to release their resources,
+	// but nothing they write as they close reaches the output
+	var closed bool
+	output := bytes.NewBuffer(nil)
+	w, err := chain.NewWriteBuilder(func(w io.WriteCloser) (io.WriteCloser, error) {
+		return chain.WriteCloser2{WriteCloser: &closeRecorder{closed: &closed}, Closer: w}, nil
+	}).
+		Then((&compress.ZstdConfig{}).Compress).
+		WritingTo(chain.NopWriteCloser{Writer: output})
+	require.Nil(t, err)
+	_, err = io.WriteString(w, inputUpper)
+	require.Nil(t, err)
+	n := output.Len()
+
+	require.Nil(t, chain.Abort(w, io.ErrUnexpectedEOF))
+	assert.True(t, closed)
+	assert.Equal(t, n, output.Len())
+}
+
+func TestWriterAbort_OpenFiles(t *testing.T) {
+	// files that are still open when the file system is aborted aren't committed
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello world\n"), 0o644))
+
+	wfs := chain.NewWriteBuilder(ToLower).WritingToFS(chain.OS{RootDir: dir, Atomic: true})
+	f, err := wfs.Create("hello.txt")
+	require.Nil(t, err)
+	_, err = io.WriteString(f, inputUpper)
+	require.Nil(t, err)
+	require.Nil(t, chain.Abort(wfs, io.ErrUnexpectedEOF))
+
+	assert.ErrorIs(t, f.Close(), io.ErrUnexpectedEOF)
+	b, err := os.ReadFile(filepath.Join(dir, "hello.txt"))
+	require.Nil(t, err)
+	assert.Equal(t, "hello world\n", string(b))
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, entries, 1)
+}